@@ -8,6 +8,7 @@ import (
 	"github.com/opensourceways/foundation-model-server/chat/infrastructure/chatadapter"
 	"github.com/opensourceways/foundation-model-server/common/controller/middleware"
 	"github.com/opensourceways/foundation-model-server/common/infrastructure/moderationadapter"
+	finetune "github.com/opensourceways/foundation-model-server/finetune/controller"
 )
 
 func LoadConfig(path string) (Config, error) {
@@ -42,10 +43,7 @@ type chatConfig struct {
 }
 
 type finetuneConfig struct {
-	Kubeconfig string `json:"kubeconfig"`
-	Namespace  string `json:"namespace"`
-	Tokens     string `json:"token_file"`
-	Image      string `json:"image"`
+	finetune.Config
 }
 
 func (cfg *chatConfig) SetDefault() {
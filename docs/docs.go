@@ -1,4 +1,5 @@
-// Package docs Code generated by swaggo/swag. DO NOT EDIT
+// Code generated by swaggo/swag. DO NOT EDIT.
+
 package docs
 
 import "github.com/swaggo/swag"
@@ -69,19 +70,86 @@ const docTemplate = `{
                 }
             }
         },
-        "/v1/job": {
+        "/v1/finetune/archived-jobs": {
             "get": {
-                "description": "list jobs",
+                "description": "list the finetunes deleted after their retention",
                 "tags": [
                     "Finetune"
                 ],
+                "summary": "List",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "creator of job",
+                        "name": "username",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/controller.JobInfo"
+                                "$ref": "#/definitions/controller.ArchivedJob"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/finetune/archived-jobs/{jobname}": {
+            "get": {
+                "description": "get a finetune deleted after its retention, its logs are read by the archived logs",
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "Get",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "finetune id",
+                        "name": "jobname",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/controller.ArchivedJob"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/finetune/datasets": {
+            "get": {
+                "description": "list datasets",
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "List",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/controller.DatasetInfo"
                             }
                         }
                     },
@@ -94,30 +162,42 @@ const docTemplate = `{
                 }
             },
             "post": {
-                "description": "create finetune",
+                "description": "upload a dataset of JSON or JSON lines",
                 "consumes": [
-                    "application/json"
+                    "multipart/form-data"
                 ],
                 "tags": [
                     "Finetune"
                 ],
-                "summary": "Create",
+                "summary": "Upload",
                 "parameters": [
                     {
-                        "description": "body of creating finetune",
-                        "name": "body",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/controller.JobInfo"
-                        }
+                        "type": "string",
+                        "description": "dataset name",
+                        "name": "name",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "owner of dataset",
+                        "name": "username",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "file",
+                        "description": "dataset file",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/controller.JobInfo"
+                            "$ref": "#/definitions/controller.DatasetInfo"
                         }
                     },
                     "500": {
@@ -129,33 +209,51 @@ const docTemplate = `{
                 }
             }
         },
-        "/v1/job/{jobname}": {
-            "delete": {
-                "description": "delete finetune",
-                "consumes": [
-                    "application/json"
-                ],
+        "/v1/finetune/datasets/{id}": {
+            "get": {
+                "description": "get a dataset with a sample of its records",
                 "tags": [
                     "Finetune"
                 ],
-                "summary": "Delete",
+                "summary": "Get",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "finetune id",
-                        "name": "jobname",
+                        "description": "dataset id",
+                        "name": "id",
                         "in": "path",
                         "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/controller.DatasetDetail"
+                        }
                     },
-                    {
-                        "description": "secret",
-                        "name": "secret",
-                        "in": "body",
-                        "required": true,
+                    "500": {
+                        "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/controller.Secret"
+                            "type": "system_error"
                         }
                     }
+                }
+            },
+            "delete": {
+                "description": "delete a dataset",
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "Delete",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "dataset id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
                 "responses": {
                     "200": {
@@ -170,22 +268,19 @@ const docTemplate = `{
                 }
             }
         },
-        "/v1/log/{jobname}": {
+        "/v1/finetune/evals/compare": {
             "get": {
-                "description": "watch single finetune",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "compare the evaluation scores of finetunes",
                 "tags": [
                     "Finetune"
                 ],
-                "summary": "get a websocket to watch a finetune log",
+                "summary": "Compare",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "finetune id",
-                        "name": "jobname",
-                        "in": "path",
+                        "description": "finetune ids separated by comma",
+                        "name": "jobs",
+                        "in": "query",
                         "required": true
                     }
                 ],
@@ -193,7 +288,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/controller.EvalComparison"
                         }
                     },
                     "500": {
@@ -204,57 +299,1693 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "controller.JobInfo": {
-            "type": "object",
-            "properties": {
-                "created_at": {
-                    "type": "string"
-                },
-                "dataset": {
-                    "type": "string"
-                },
-                "jobName": {
-                    "type": "string"
-                },
-                "model": {
-                    "type": "string"
-                },
-                "parameter": {
-                    "type": "object",
-                    "additionalProperties": {
-                        "type": "string"
+        },
+        "/v1/finetune/models": {
+            "get": {
+                "description": "list models which can be finetuned",
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "List",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/controller.BaseModel"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
                     }
-                },
-                "secret": {
-                    "type": "string"
-                },
-                "status": {
-                    "type": "string"
-                },
-                "username": {
-                    "type": "string"
                 }
             }
         },
-        "controller.ResponseData": {
-            "type": "object",
-            "properties": {
-                "code": {
-                    "type": "string"
-                },
-                "data": {},
-                "msg": {
-                    "type": "string"
+        "/v1/finetune/sweeps": {
+            "get": {
+                "description": "list sweeps",
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "List",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "creator of sweep",
+                        "name": "username",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/controller.SweepInfo"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "create a sweep which runs the base finetune with every configuration of the search space",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "Create",
+                "parameters": [
+                    {
+                        "description": "body of creating sweep",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/controller.SweepRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/controller.SweepInfo"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
                 }
             }
         },
-        "controller.Secret": {
-            "type": "object",
-            "properties": {
-                "secret": {
+        "/v1/finetune/sweeps/{id}": {
+            "get": {
+                "description": "get a sweep with the status and metric of every trial and the best one",
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "Get",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "sweep id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/controller.SweepInfo"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/finetune/sweeps/{id}/cancel": {
+            "post": {
+                "description": "cancel a sweep, its pending trials are not submitted and the jobs of others are cancelled",
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "Cancel",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "sweep id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/controller.SweepInfo"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/finetune/templates/{name}/schema": {
+            "get": {
+                "description": "get the parameter schema of a finetune template",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "Schema",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "template name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/controller.ParameterSchema"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/finetune/webhooks": {
+            "get": {
+                "description": "list the webhooks registered by the token",
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "List",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "owner of webhook",
+                        "name": "username",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "finetune id",
+                        "name": "jobname",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/controller.Webhook"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "register a webhook which is notified when the status of job changes, the secret is only returned here",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "Create",
+                "parameters": [
+                    {
+                        "description": "body of registering webhook",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/controller.WebhookRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/controller.Webhook"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/finetune/webhooks/{id}": {
+            "delete": {
+                "description": "delete a webhook and its deliveries",
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "Delete",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "webhook id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/finetune/webhooks/{id}/deliveries": {
+            "get": {
+                "description": "list the deliveries of a webhook from the newest, every attempt is a delivery",
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "Deliveries",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "webhook id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "max deliveries, default 100",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/controller.WebhookDelivery"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/job": {
+            "get": {
+                "description": "list jobs, the token of next page is returned in the header of X-Continue",
+                "tags": [
+                    "Finetune"
+                ],
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "creator of job",
+                        "name": "username",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "base model",
+                        "name": "model",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "dataset id",
+                        "name": "dataset",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "job status",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC3339 time",
+                        "name": "created_after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC3339 time",
+                        "name": "created_before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "asc or desc by creation time, default asc",
+                        "name": "order",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "max jobs of a page",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "token of the page",
+                        "name": "continue",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/controller.JobInfo"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "create finetune",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "Create",
+                "parameters": [
+                    {
+                        "description": "body of creating finetune",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/controller.JobInfo"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/controller.JobInfo"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/job/{jobname}": {
+            "delete": {
+                "description": "delete finetune",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "Delete",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "finetune id",
+                        "name": "jobname",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/job/{jobname}/artifacts": {
+            "get": {
+                "description": "list the artifacts of a finetune job",
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "Artifacts",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "finetune id",
+                        "name": "jobname",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/controller.Artifact"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/job/{jobname}/artifacts/download": {
+            "get": {
+                "description": "download the artifacts of a finetune job as a tar.gz archive",
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "Download",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "finetune id",
+                        "name": "jobname",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "artifact path, all artifacts if empty",
+                        "name": "path",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/job/{jobname}/cancel": {
+            "post": {
+                "description": "stop a finetune, the job and its logs, metrics and artifacts are kept",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "Cancel",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "finetune id",
+                        "name": "jobname",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/job/{jobname}/deploy": {
+            "post": {
+                "description": "deploy a finetuned model to the chat service",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "Deploy",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "finetune id",
+                        "name": "jobname",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "body of deploying finetuned model",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/controller.DeployRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "remove a finetuned model from the chat service",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "Undeploy",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "finetune id",
+                        "name": "jobname",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/job/{jobname}/events": {
+            "get": {
+                "description": "list the kubernetes events of a finetune job and its pods",
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "Events",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "finetune id",
+                        "name": "jobname",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/controller.JobEvent"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/job/{jobname}/logs": {
+            "get": {
+                "description": "get the archived logs of a finetune job",
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "Logs",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "finetune id",
+                        "name": "jobname",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "byte offset in the archive",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "max bytes",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "number of lines from the end",
+                        "name": "tailLines",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "only the logs newer than it",
+                        "name": "sinceSeconds",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "add timestamp to every line",
+                        "name": "timestamps",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/job/{jobname}/metrics": {
+            "get": {
+                "description": "get the training metrics of a finetune job",
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "Metrics",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "finetune id",
+                        "name": "jobname",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/controller.MetricPoint"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/job/{jobname}/metrics/watch": {
+            "get": {
+                "description": "watch the training metrics of a finetune job",
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "get a websocket to watch the training metrics",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "finetune id",
+                        "name": "jobname",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/controller.MetricPoint"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/job/{jobname}/retention": {
+            "post": {
+                "description": "override the retention policy of a finetune, 0 restores the policy and -1 keeps it forever",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "Retention",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "finetune id",
+                        "name": "jobname",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "body of changing retention",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/controller.RetentionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/job/{jobname}/retry": {
+            "post": {
+                "description": "create a new attempt of a finished finetune with the same parameters",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "Retry",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "finetune id",
+                        "name": "jobname",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "body of retrying finetune",
+                        "name": "body",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/controller.RetryRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/controller.JobInfo"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/log/{jobname}": {
+            "get": {
+                "description": "watch single finetune",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Finetune"
+                ],
+                "summary": "get a websocket or a server-sent events stream to watch a finetune log",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "finetune id",
+                        "name": "jobname",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "number of lines from the end",
+                        "name": "tailLines",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "only the logs newer than it",
+                        "name": "sinceSeconds",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "add timestamp to every line",
+                        "name": "timestamps",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "follow the logs, default true",
+                        "name": "follow",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "sse or websocket, default websocket",
+                        "name": "transport",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "system_error"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "controller.ArchivedJob": {
+            "type": "object",
+            "properties": {
+                "archived_at": {
+                    "type": "string"
+                },
+                "attempt": {
+                    "type": "integer"
+                },
+                "cluster": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "credentials": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "dataset": {
+                    "type": "string"
+                },
+                "eval_results": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/controller.EvalResult"
+                    }
+                },
+                "evals": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/controller.JobEvent"
+                    }
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "jobName": {
+                    "type": "string"
+                },
+                "model": {
+                    "type": "string"
+                },
+                "nodes": {
+                    "type": "integer"
+                },
+                "output": {
+                    "type": "string"
+                },
+                "owner": {
+                    "description": "Owner is the hash of token which created the job, it is not returned",
+                    "type": "string"
+                },
+                "parameter": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "priority": {
+                    "type": "integer"
+                },
+                "queue_position": {
+                    "type": "integer"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "resume_from": {
+                    "type": "string"
+                },
+                "retention_days": {
+                    "type": "integer"
+                },
+                "retry_of": {
+                    "type": "string"
+                },
+                "served_model": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "sweep": {
+                    "type": "string"
+                },
+                "template": {
+                    "type": "string"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "controller.Artifact": {
+            "type": "object",
+            "properties": {
+                "is_dir": {
+                    "type": "boolean"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "mod_time": {
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                }
+            }
+        },
+        "controller.BaseModel": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string"
+                },
+                "path": {
+                    "description": "Path is relative to the model volume, it is the name of model by default",
+                    "type": "string"
+                },
+                "resources": {
+                    "description": "Resources overrides the resources of template if set",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/controller.TemplateResources"
+                        }
+                    ]
+                },
+                "size": {
+                    "type": "string"
+                },
+                "templates": {
+                    "description": "Templates are the names of templates which support this model, all templates are supported if empty",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "controller.DatasetDetail": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "format": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "owner": {
+                    "description": "Owner is the hash of token which uploaded the dataset, it is not returned",
+                    "type": "string"
+                },
+                "records": {
+                    "type": "integer"
+                },
+                "sample": {
+                    "type": "array",
+                    "items": {
+                        "type": "object"
+                    }
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "controller.DatasetInfo": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "format": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "owner": {
+                    "description": "Owner is the hash of token which uploaded the dataset, it is not returned",
+                    "type": "string"
+                },
+                "records": {
+                    "type": "integer"
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "controller.DeployRequest": {
+            "type": "object",
+            "properties": {
+                "model_name": {
+                    "type": "string"
+                }
+            }
+        },
+        "controller.EvalComparison": {
+            "type": "object",
+            "properties": {
+                "jobs": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/controller.JobScores"
+                    }
+                },
+                "suites": {
+                    "description": "Suites are the names of scores reported by every suite",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "controller.EvalResult": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "jobName": {
+                    "type": "string"
+                },
+                "scores": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "number"
+                    }
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "controller.JobEvent": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer"
+                },
+                "first_seen": {
+                    "type": "string"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "last_seen": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "controller.JobInfo": {
+            "type": "object",
+            "properties": {
+                "attempt": {
+                    "type": "integer"
+                },
+                "cluster": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "credentials": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "dataset": {
+                    "type": "string"
+                },
+                "eval_results": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/controller.EvalResult"
+                    }
+                },
+                "evals": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "jobName": {
+                    "type": "string"
+                },
+                "model": {
+                    "type": "string"
+                },
+                "nodes": {
+                    "type": "integer"
+                },
+                "output": {
+                    "type": "string"
+                },
+                "parameter": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "priority": {
+                    "type": "integer"
+                },
+                "queue_position": {
+                    "type": "integer"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "resume_from": {
+                    "type": "string"
+                },
+                "retention_days": {
+                    "type": "integer"
+                },
+                "retry_of": {
+                    "type": "string"
+                },
+                "served_model": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "sweep": {
+                    "type": "string"
+                },
+                "template": {
+                    "type": "string"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "controller.JobScores": {
+            "type": "object",
+            "properties": {
+                "dataset": {
+                    "type": "string"
+                },
+                "jobName": {
+                    "type": "string"
+                },
+                "model": {
+                    "type": "string"
+                },
+                "parameter": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "scores": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "object",
+                        "additionalProperties": {
+                            "type": "number"
+                        }
+                    }
+                },
+                "template": {
+                    "type": "string"
+                }
+            }
+        },
+        "controller.MetricPoint": {
+            "type": "object",
+            "properties": {
+                "epoch": {
+                    "type": "number"
+                },
+                "eta": {
+                    "type": "string"
+                },
+                "learning_rate": {
+                    "type": "number"
+                },
+                "loss": {
+                    "type": "number"
+                },
+                "step": {
+                    "type": "integer"
+                },
+                "throughput": {
+                    "type": "number"
+                },
+                "time": {
+                    "type": "string"
+                }
+            }
+        },
+        "controller.ParameterSchema": {
+            "type": "object",
+            "properties": {
+                "default": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "max": {
+                    "type": "number"
+                },
+                "min": {
+                    "type": "number"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                },
+                "values": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "controller.ResponseData": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string"
+                },
+                "data": {},
+                "msg": {
+                    "type": "string"
+                }
+            }
+        },
+        "controller.RetentionRequest": {
+            "type": "object",
+            "properties": {
+                "days": {
+                    "description": "Days overrides the retention policy, 0 means the policy and -1 means forever",
+                    "type": "integer"
+                }
+            }
+        },
+        "controller.RetryRequest": {
+            "type": "object",
+            "properties": {
+                "checkpoint": {
+                    "description": "Checkpoint is the checkpoint to resume from, the latest one if empty",
+                    "type": "string"
+                },
+                "resume": {
+                    "description": "Resume passes the checkpoint of the job to the new attempt",
+                    "type": "boolean"
+                }
+            }
+        },
+        "controller.SweepInfo": {
+            "type": "object",
+            "properties": {
+                "base": {
+                    "$ref": "#/definitions/controller.JobInfo"
+                },
+                "best": {
+                    "$ref": "#/definitions/controller.SweepTrial"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "goal": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "max_parallel": {
+                    "type": "integer"
+                },
+                "method": {
+                    "type": "string"
+                },
+                "metric": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "trials": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/controller.SweepTrial"
+                    }
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "controller.SweepRequest": {
+            "type": "object",
+            "properties": {
+                "base": {
+                    "description": "Base is the job of which the parameters are overridden by every trial",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/controller.JobInfo"
+                        }
+                    ]
+                },
+                "goal": {
+                    "description": "Goal is min or max, it depends on the metric by default",
+                    "type": "string"
+                },
+                "max_parallel": {
+                    "description": "MaxParallel is the max number of jobs running at the same time",
+                    "type": "integer"
+                },
+                "method": {
+                    "description": "Method is grid or random, default grid",
+                    "type": "string"
+                },
+                "metric": {
+                    "description": "Metric is the final metric of job to compare, loss or throughput, default loss",
+                    "type": "string"
+                },
+                "samples": {
+                    "description": "Samples is the number of configurations sampled by the random search",
+                    "type": "integer"
+                },
+                "space": {
+                    "description": "Space is the values to search of every parameter",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "controller.SweepTrial": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "jobName": {
+                    "type": "string"
+                },
+                "metric": {
+                    "type": "number"
+                },
+                "parameter": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "controller.TemplateResources": {
+            "type": "object",
+            "properties": {
+                "cpu": {
+                    "type": "string"
+                },
+                "memory": {
+                    "type": "string"
+                },
+                "nodes": {
+                    "description": "Nodes is the number of nodes of the data-parallel job, NPU is the number on every node",
+                    "type": "integer"
+                },
+                "npu": {
+                    "type": "integer"
+                },
+                "npu_resource": {
+                    "type": "string"
+                }
+            }
+        },
+        "controller.Webhook": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "type": "string"
+                },
+                "jobName": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "controller.WebhookDelivery": {
+            "type": "object",
+            "properties": {
+                "attempt": {
+                    "type": "integer"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "event": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "jobName": {
+                    "type": "string"
+                },
+                "status_code": {
+                    "type": "integer"
+                },
+                "success": {
+                    "type": "boolean"
+                },
+                "time": {
+                    "type": "string"
+                }
+            }
+        },
+        "controller.WebhookRequest": {
+            "type": "object",
+            "properties": {
+                "events": {
+                    "description": "Events are the events to notify, all the events are notified if empty",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "jobName": {
+                    "description": "JobName is the job to notify, all the jobs of user are notified if empty",
+                    "type": "string"
+                },
+                "secret": {
+                    "description": "Secret is the key of HMAC-SHA256 signature of the body, it is generated if empty",
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                },
+                "username": {
                     "type": "string"
                 }
             }
@@ -0,0 +1,363 @@
+package controller
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/opensourceways/foundation-model-server/allerror"
+	commonctl "github.com/opensourceways/foundation-model-server/common/controller"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	envOutputDir = "OUTPUT_DIR"
+
+	artifactCheckpoint = "checkpoint"
+	artifactAdapter    = "adapter"
+	artifactConfig     = "config"
+	artifactMetrics    = "metrics"
+	artifactOther      = "other"
+)
+
+var artifactCfg ArtifactConfig
+
+// ArtifactConfig
+type ArtifactConfig struct {
+	// Dir is where the output volume is mounted in the server
+	Dir string `json:"dir"`
+}
+
+func (cfg *ArtifactConfig) setDefault() {
+	if cfg.Dir == "" {
+		cfg.Dir = "/data/disk1/output"
+	}
+}
+
+// Artifact is a file or directory produced by a finetune job
+type Artifact struct {
+	Path    string `json:"path"`
+	Kind    string `json:"kind"`
+	Size    int64  `json:"size"`
+	IsDir   bool   `json:"is_dir"`
+	ModTime string `json:"mod_time"`
+}
+
+func hasOutputVolume() bool {
+	return !volumeCfg.Output.isEmpty()
+}
+
+func artifactKind(name string, isDir bool) string {
+	lower := strings.ToLower(name)
+
+	switch {
+	case isDir && strings.HasPrefix(lower, "checkpoint"):
+		return artifactCheckpoint
+	case strings.HasPrefix(lower, "adapter"):
+		return artifactAdapter
+	case strings.HasSuffix(lower, "metrics.json") || strings.HasSuffix(lower, "results.json") ||
+		lower == "trainer_state.json":
+		return artifactMetrics
+	case lower == "training_args.json" || lower == "training_args.bin" ||
+		strings.HasSuffix(lower, ".yaml") || strings.HasSuffix(lower, "config.json"):
+		return artifactConfig
+	default:
+		return artifactOther
+	}
+}
+
+// jobOutputDir returns the directory where the job writes its outputs
+func jobOutputDir(jobName string) (string, error) {
+	if !hasOutputVolume() {
+		return "", allerror.NewNotFound("no output volume is configured")
+	}
+
+	if _, err := uuid.Parse(jobName); err != nil {
+		return "", allerror.New(allerror.ErrorBadRequestParam, fmt.Sprintf("invalid job: %s", jobName))
+	}
+
+	dir := filepath.Join(artifactCfg.Dir, jobName)
+	if _, err := os.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			return "", allerror.NewNotFound(fmt.Sprintf("no artifacts of job %s", jobName))
+		}
+
+		return "", err
+	}
+
+	return dir, nil
+}
+
+// checkArtifactPerm checks whether the artifacts of job can be read by the token. The
+// artifacts are kept after the job is deleted, the owner of job is read from its archive then.
+func checkArtifactPerm(jobName, secret string) error {
+	if secret == "" {
+		return allerror.New(allerror.ErrorPermissionDeny, "Permission denied, empty finetune token")
+	}
+
+	if _, err := getJob(jobName); err == nil || !isNotFound(err) {
+		return checkJobPerm(jobName, secret, "read the artifacts of")
+	}
+
+	v, err := reaper.store.Get(jobName)
+	if err != nil {
+		if _, ok := err.(interface{ NotFound() }); ok {
+			return allerror.New(allerror.ErrorPermissionDeny, "Permission denied, the owner of job is unknown")
+		}
+
+		return err
+	}
+
+	if v.Owner == "" || subtle.ConstantTimeCompare([]byte(v.Owner), []byte(ownerHash(secret))) != 1 {
+		return allerror.New(allerror.ErrorPermissionDeny, "Permission denied, you can't read the artifacts of jobs created by others")
+	}
+
+	return nil
+}
+
+func dirSize(dir string) (size int64, err error) {
+	err = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+
+			size += info.Size()
+		}
+
+		return nil
+	})
+
+	return
+}
+
+func listArtifacts(dir string) ([]Artifact, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	r := make([]Artifact, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		size := info.Size()
+		if e.IsDir() {
+			if size, err = dirSize(filepath.Join(dir, e.Name())); err != nil {
+				return nil, err
+			}
+		}
+
+		r = append(r, Artifact{
+			Path:    e.Name(),
+			Kind:    artifactKind(e.Name(), e.IsDir()),
+			Size:    size,
+			IsDir:   e.IsDir(),
+			ModTime: info.ModTime().Format(time.RFC3339),
+		})
+	}
+
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].Path < r[j].Path
+	})
+
+	return r, nil
+}
+
+// resolveArtifact returns the real path of the artifact p under dir. The symlinks created
+// by the job are resolved, and the artifact must not be out of dir after resolved.
+func resolveArtifact(dir, p string) (string, error) {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+
+	notFound := allerror.NewNotFound(fmt.Sprintf("artifact %s not found", p))
+
+	target, err := filepath.EvalSymlinks(filepath.Join(dir, p))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", notFound
+		}
+
+		return "", err
+	}
+
+	rel, err := filepath.Rel(root, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", notFound
+	}
+
+	return target, nil
+}
+
+// writeArchive writes the files under src as a tar.gz stream, they are named under name.
+// The symlinks under src are not followed.
+func writeArchive(w io.Writer, src, name string) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		rel = filepath.Join(name, rel)
+		if rel == "." {
+			return nil
+		}
+
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gw.Close()
+}
+
+// @Summary		Artifacts
+// @Description	list the artifacts of a finetune job
+// @Tags			Finetune
+// @Param			jobname	path	string	true	"finetune id"
+// @Success		200	{object}		[]Artifact
+// @Failure		500	system_error	system	error
+// @Router			/v1/job/{jobname}/artifacts [get]
+func getJobArtifacts(c *gin.Context) {
+	jobName := c.Param("jobname")
+
+	if err := checkArtifactPerm(jobName, c.GetHeader(headerSecret)); err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	dir, err := jobOutputDir(jobName)
+	if err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	v, err := listArtifacts(dir)
+	if err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, v)
+}
+
+// @Summary		Download
+// @Description	download the artifacts of a finetune job as a tar.gz archive
+// @Tags			Finetune
+// @Param			jobname	path	string	true	"finetune id"
+// @Param			path	query	string	false	"artifact path, all artifacts if empty"
+// @Success		200
+// @Failure		500	system_error	system	error
+// @Router			/v1/job/{jobname}/artifacts/download [get]
+func downloadJobArtifacts(c *gin.Context) {
+	jobName := c.Param("jobname")
+
+	if err := checkArtifactPerm(jobName, c.GetHeader(headerSecret)); err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	dir, err := jobOutputDir(jobName)
+	if err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	p := "."
+	if v := c.Query("path"); v != "" {
+		if p, err = subPath(v); err != nil {
+			commonctl.SendBadRequestParam(c, err)
+			logrus.Error(err.Error())
+			return
+		}
+	}
+
+	src, err := resolveArtifact(dir, p)
+	if err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	name := jobName
+	if p != "." {
+		name += "-" + strings.ReplaceAll(p, "/", "-")
+	}
+
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".tar.gz"))
+	c.Status(http.StatusOK)
+
+	if err := writeArchive(c.Writer, src, p); err != nil {
+		logrus.Errorf("write archive of job %s failed, err:%s", jobName, err.Error())
+	}
+}
@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// newArtifactDir creates the outputs of a job which has the symlinks to the files in and out of it
+func newArtifactDir(t *testing.T) (dir string) {
+	base := t.TempDir()
+	dir = filepath.Join(base, "job")
+	outside := filepath.Join(base, "secret")
+
+	for _, d := range []string{filepath.Join(dir, "model"), outside} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := map[string]string{
+		filepath.Join(dir, "model", "adapter.bin"): "adapter",
+		filepath.Join(dir, "train.log"):            "log",
+		filepath.Join(outside, "token"):            "token",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	links := map[string]string{
+		"latest": "model",
+		"escape": outside,
+		"parent": "..",
+		"token":  filepath.Join(outside, "token"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func archiveNames(t *testing.T, src, name string) []string {
+	var buf bytes.Buffer
+	if err := writeArchive(&buf, src, name); err != nil {
+		t.Fatal(err)
+	}
+
+	gr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names = append(names, hdr.Name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func TestResolveArtifact(t *testing.T) {
+	dir := newArtifactDir(t)
+
+	for _, p := range []string{".", "model", "train.log", "latest"} {
+		if _, err := resolveArtifact(dir, p); err != nil {
+			t.Errorf("resolve %s failed, err:%v", p, err)
+		}
+	}
+
+	for _, p := range []string{"escape", "parent", "token", "escape/token", "missing"} {
+		if _, err := resolveArtifact(dir, p); err == nil {
+			t.Errorf("resolve %s: the artifact out of the output dir is resolved", p)
+		}
+	}
+}
+
+func TestWriteArchive(t *testing.T) {
+	dir := newArtifactDir(t)
+
+	root, err := resolveArtifact(dir, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the symlinks are not followed
+	want := []string{"model", "model/adapter.bin", "train.log"}
+	if got := archiveNames(t, root, "."); !reflect.DeepEqual(got, want) {
+		t.Errorf("archive of all = %v, want %v", got, want)
+	}
+
+	latest, err := resolveArtifact(dir, "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = []string{"latest", "latest/adapter.bin"}
+	if got := archiveNames(t, latest, "latest"); !reflect.DeepEqual(got, want) {
+		t.Errorf("archive of latest = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opensourceways/foundation-model-server/allerror"
+	commonctl "github.com/opensourceways/foundation-model-server/common/controller"
+	"github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	annotationCancelled = "finetune/cancelled-at"
+	statusCancelled     = "Cancelled"
+)
+
+var cancelCfg CancelConfig
+
+// CancelConfig
+type CancelConfig struct {
+	// GracePeriod is the seconds for the training script to save the checkpoint after
+	// receiving SIGTERM when the job is cancelled
+	GracePeriod int64 `json:"grace_period"`
+}
+
+func (cfg *CancelConfig) setDefault() {
+	if cfg.GracePeriod <= 0 {
+		cfg.GracePeriod = 120
+	}
+}
+
+func isCancelled(job *batchv1.Job) bool {
+	return job.Annotations[annotationCancelled] != ""
+}
+
+// doCancelJob stops the job, then kubernetes terminates its pods gracefully
+// within the grace period of the pod template.
+func doCancelJob(jobName string) error {
+	job, err := getJob(jobName)
+	if err != nil {
+		logrus.Error(err.Error())
+		return fmt.Errorf("get job info failed")
+	}
+
+	if isTerminalStatus(jobStatus(job)) {
+		return allerror.New(allerror.ErrorFinetune, fmt.Sprintf("job %s is %s", jobName, jobStatus(job)))
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				annotationCancelled: time.Now().Format(time.RFC3339),
+			},
+		},
+		"spec": cancelSpec(job),
+	})
+	if err != nil {
+		return err
+	}
+
+	cl, err := clusterOf(job)
+	if err != nil {
+		logrus.Error(err.Error())
+		return fmt.Errorf("cancel job failed")
+	}
+
+	_, err = cl.clientset.BatchV1().Jobs(cl.Namespace).Patch(
+		context.TODO(), jobName, types.MergePatchType, patch, metav1.PatchOptions{},
+	)
+	if err != nil {
+		logrus.Error(err.Error())
+		return fmt.Errorf("cancel job failed")
+	}
+
+	return nil
+}
+
+// @Summary		Cancel
+// @Description	stop a finetune, the job and its logs, metrics and artifacts are kept
+// @Tags			Finetune
+// @Param			jobname	path	string	true	"finetune id"
+// @Accept			json
+// @Success		200
+// @Failure		500	system_error	system	error
+// @Router			/v1/job/{jobname}/cancel [post]
+func cancelJob(c *gin.Context) {
+	jobName := c.Param("jobname")
+
+	if err := checkJobPerm(jobName, c.GetHeader(headerSecret), "cancel"); err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	if err := doCancelJob(jobName); err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"msg": fmt.Sprintf("Job %s cancelled", jobName),
+	})
+}
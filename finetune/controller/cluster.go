@@ -0,0 +1,354 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/opensourceways/foundation-model-server/allerror"
+	"github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	labelCluster       = "cluster"
+	defaultClusterName = "default"
+
+	placementSpread = "spread"
+	placementPack   = "pack"
+)
+
+var (
+	clusters     []*cluster
+	placementCfg PlacementConfig
+)
+
+// ClusterConfig is a kubernetes cluster where the finetune jobs run. The templates, models
+// and volumes are the same in every cluster. The claims of the dataset and output volumes
+// must be bound to the same shared storage as the dataset and artifact dirs of the server
+// in every cluster, otherwise the jobs can't read the datasets or resume from the checkpoints
+// and the server can't read the outputs of the jobs run in other clusters.
+type ClusterConfig struct {
+	Name       string `json:"name"       required:"true"`
+	Kubeconfig string `json:"kubeconfig"`
+	Namespace  string `json:"namespace"`
+	// Registry replaces the registry of the images of the jobs run in the cluster
+	Registry string `json:"registry"`
+	// Capacity is the max NPUs used by the finetune jobs in the cluster, 0 means all the allocatable
+	// NPUs. The NPUs are counted from the pods in the namespace if it is set, otherwise the nodes
+	// and the pods of all the namespaces are watched which needs the permission of the cluster.
+	Capacity int `json:"capacity"`
+}
+
+func (cfg *ClusterConfig) setDefault(namespace string) {
+	if cfg.Namespace == "" {
+		cfg.Namespace = namespace
+	}
+}
+
+func (cfg *ClusterConfig) validate() error {
+	if cfg.Name == "" {
+		return errors.New("missing finetune cluster name")
+	}
+
+	if errs := validation.IsValidLabelValue(cfg.Name); len(errs) > 0 {
+		return fmt.Errorf("invalid finetune cluster name %s, %s", cfg.Name, strings.Join(errs, ","))
+	}
+
+	if cfg.Capacity < 0 {
+		return fmt.Errorf("invalid capacity of finetune cluster %s", cfg.Name)
+	}
+
+	return nil
+}
+
+// PlacementConfig chooses the cluster where a job runs if the job doesn't specify it
+type PlacementConfig struct {
+	// Policy is spread which chooses the cluster with the most free NPUs, or pack
+	// which chooses the first cluster with enough free NPUs by the order of clusters.
+	Policy string `json:"policy"`
+}
+
+func (cfg *PlacementConfig) setDefault() {
+	if cfg.Policy == "" {
+		cfg.Policy = placementSpread
+	}
+}
+
+func (cfg *PlacementConfig) validate() error {
+	switch cfg.Policy {
+	case placementSpread, placementPack:
+		return nil
+	default:
+		return fmt.Errorf("unknown placement policy: %s", cfg.Policy)
+	}
+}
+
+// cluster is the clients of a cluster where the finetune jobs run
+type cluster struct {
+	ClusterConfig
+
+	clientset kubernetes.Interface
+	// dynamic creates the objects of the scheduler backend
+	dynamic dynamic.Interface
+
+	// nodes are started when the allocatable NPUs of cluster are counted first time
+	nodesMutex sync.Mutex
+	nodes      *nodeListers
+}
+
+// nodeListers lists the nodes of finetune jobs and the pods which are not finished in all the namespaces
+type nodeListers struct {
+	nodeLister corelisters.NodeLister
+	podLister  corelisters.PodLister
+}
+
+func (cl *cluster) nodeListers() (*nodeListers, error) {
+	cl.nodesMutex.Lock()
+	defer cl.nodesMutex.Unlock()
+
+	if cl.nodes != nil {
+		return cl.nodes, nil
+	}
+
+	stop := make(chan struct{})
+
+	nodeFactory := informers.NewSharedInformerFactoryWithOptions(
+		cl.clientset, 0, informers.WithTweakListOptions(func(opt *metav1.ListOptions) {
+			opt.LabelSelector = labels.SelectorFromSet(volumeCfg.NodeSelector).String()
+		}),
+	)
+	podFactory := informers.NewSharedInformerFactoryWithOptions(
+		cl.clientset, 0, informers.WithTweakListOptions(func(opt *metav1.ListOptions) {
+			opt.FieldSelector = "status.phase!=Succeeded,status.phase!=Failed"
+		}),
+	)
+
+	l := &nodeListers{
+		nodeLister: nodeFactory.Core().V1().Nodes().Lister(),
+		podLister:  podFactory.Core().V1().Pods().Lister(),
+	}
+
+	nodeFactory.Start(stop)
+	podFactory.Start(stop)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cacheSyncTimeout)
+	defer cancel()
+
+	for _, f := range []informers.SharedInformerFactory{nodeFactory, podFactory} {
+		for t, ok := range f.WaitForCacheSync(ctx.Done()) {
+			if !ok {
+				close(stop)
+
+				return nil, fmt.Errorf("sync cache of %s in cluster %s failed", t.String(), cl.Name)
+			}
+		}
+	}
+
+	cl.nodes = l
+
+	return l, nil
+}
+
+func newCluster(cfg *ClusterConfig) (*cluster, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", cfg.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Kubeconfig != "" {
+		defer os.Remove(cfg.Kubeconfig)
+	}
+
+	cl := &cluster{ClusterConfig: *cfg}
+
+	if cl.clientset, err = kubernetes.NewForConfig(config); err != nil {
+		return nil, err
+	}
+
+	if schedulerCfg.Backend == backendVolcano {
+		if cl.dynamic, err = dynamic.NewForConfig(config); err != nil {
+			return nil, err
+		}
+	}
+
+	return cl, nil
+}
+
+func initClusters(cfg []ClusterConfig) error {
+	clusters = make([]*cluster, 0, len(cfg))
+
+	for i := range cfg {
+		cl, err := newCluster(&cfg[i])
+		if err != nil {
+			return fmt.Errorf("init finetune cluster %s failed, err:%s", cfg[i].Name, err.Error())
+		}
+
+		clusters = append(clusters, cl)
+	}
+
+	if len(clusters) < 2 {
+		return nil
+	}
+
+	for _, cl := range clusters {
+		if err := cl.checkClaims(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkClaims checks the claims of the volumes are bound in the cluster
+func (cl *cluster) checkClaims() error {
+	for _, v := range []*VolumeSource{&volumeCfg.Model, &volumeCfg.Dataset, &volumeCfg.Output} {
+		if v.ClaimName == "" {
+			continue
+		}
+
+		pvc, err := cl.clientset.CoreV1().PersistentVolumeClaims(cl.Namespace).Get(
+			context.TODO(), v.ClaimName, metav1.GetOptions{},
+		)
+		if err != nil {
+			return fmt.Errorf("get claim %s in finetune cluster %s failed, err:%s", v.ClaimName, cl.Name, err.Error())
+		}
+
+		if pvc.Status.Phase != corev1.ClaimBound {
+			return fmt.Errorf("claim %s in finetune cluster %s is not bound", v.ClaimName, cl.Name)
+		}
+	}
+
+	return nil
+}
+
+func getCluster(name string) (*cluster, error) {
+	for _, cl := range clusters {
+		if cl.Name == name {
+			return cl, nil
+		}
+	}
+
+	return nil, allerror.New(allerror.ErrorBadRequestParam, fmt.Sprintf("unknown cluster: %s", name))
+}
+
+// clusterOf returns the cluster where the job runs, the jobs created before
+// the cluster is recorded run in the first cluster.
+func clusterOf(job *batchv1.Job) (*cluster, error) {
+	name := job.Labels[labelCluster]
+	if name == "" {
+		return clusters[0], nil
+	}
+
+	for _, cl := range clusters {
+		if cl.Name == name {
+			return cl, nil
+		}
+	}
+
+	return nil, fmt.Errorf("job %s is in the unknown cluster %s", job.Name, name)
+}
+
+// image replaces the registry of image by the registry of cluster
+func (cl *cluster) image(image string) string {
+	if cl.Registry == "" || image == "" {
+		return image
+	}
+
+	name := image
+	if i := strings.Index(image, "/"); i > 0 {
+		if host := image[:i]; strings.ContainsAny(host, ".:") || host == "localhost" {
+			name = image[i+1:]
+		}
+	}
+
+	return strings.TrimSuffix(cl.Registry, "/") + "/" + name
+}
+
+// availableNPUs returns the free NPUs of cluster which are not taken by the jobs queued in it
+func (q *admissionQueue) availableNPUs(cl *cluster) (corev1.ResourceList, error) {
+	items, err := jobs.listQueuedJobs()
+	if err != nil {
+		return nil, err
+	}
+
+	free, err := q.freeNPUs(cl)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, job := range items {
+		if !isQueued(job) {
+			continue
+		}
+
+		jobCluster, err := clusterOf(job)
+		if err != nil {
+			return nil, err
+		}
+
+		if jobCluster == cl {
+			for name, v := range jobNPUs(job, q.npuResources) {
+				addQuantity(free, name, -v.Value())
+			}
+		}
+	}
+
+	return free, nil
+}
+
+// placeJob chooses the cluster where the job which needs the NPUs runs, it is the
+// cluster requested by the job if any.
+func placeJob(name string, need corev1.ResourceList) (*cluster, error) {
+	if name != "" {
+		return getCluster(name)
+	}
+
+	if len(clusters) == 1 {
+		return clusters[0], nil
+	}
+
+	var best *cluster
+	var bestFree int64
+
+	for _, cl := range clusters {
+		free, err := admission.availableNPUs(cl)
+		if err != nil {
+			logrus.Errorf("get free NPUs of cluster %s failed, err:%s", cl.Name, err.Error())
+
+			continue
+		}
+
+		if placementCfg.Policy == placementPack && fits(need, free) {
+			return cl, nil
+		}
+
+		var n int64
+		for name := range need {
+			f := free[name]
+			n += f.Value()
+		}
+
+		if best == nil || n > bestFree {
+			best, bestFree = cl, n
+		}
+	}
+
+	if best == nil {
+		return nil, allerror.New(allerror.ErrorFinetune, "no cluster is available")
+	}
+
+	return best, nil
+}
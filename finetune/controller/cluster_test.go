@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestClusterOf(t *testing.T) {
+	old := clusters
+	defer func() { clusters = old }()
+
+	first := &cluster{ClusterConfig: ClusterConfig{Name: "first"}}
+	second := &cluster{ClusterConfig: ClusterConfig{Name: "second"}}
+	clusters = []*cluster{first, second}
+
+	jobIn := func(name string) *batchv1.Job {
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "job"}}
+		if name != "" {
+			job.Labels = map[string]string{labelCluster: name}
+		}
+
+		return job
+	}
+
+	if cl, err := clusterOf(jobIn("second")); err != nil || cl != second {
+		t.Errorf("clusterOf(second) = %v, %v", cl, err)
+	}
+
+	// the jobs created before the cluster is recorded run in the first cluster
+	if cl, err := clusterOf(jobIn("")); err != nil || cl != first {
+		t.Errorf("clusterOf() = %v, %v", cl, err)
+	}
+
+	if _, err := clusterOf(jobIn("removed")); err == nil {
+		t.Error("the job in an unknown cluster falls back to another cluster")
+	}
+}
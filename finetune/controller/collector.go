@@ -0,0 +1,333 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	statusFailed = "Failed"
+
+	collectInterval = 5 * time.Second
+	resyncInterval  = time.Minute
+)
+
+var collectors = newCollectorManager()
+
+func isTerminalStatus(status string) bool {
+	return status == statusComplete || status == statusFailed || status == statusCancelled
+}
+
+// collectorManager collects the logs of every running job in background,
+// so the training progress is recorded even if nobody watches the job.
+type collectorManager struct {
+	mutex   sync.Mutex
+	running map[string]bool
+}
+
+func newCollectorManager() *collectorManager {
+	return &collectorManager{running: map[string]bool{}}
+}
+
+func (m *collectorManager) isRunning(jobName string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.running[jobName]
+}
+
+func (m *collectorManager) start(jobName string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.running[jobName] {
+		return
+	}
+	m.running[jobName] = true
+
+	go func() {
+		collectJob(jobName)
+
+		m.mutex.Lock()
+		delete(m.running, jobName)
+		m.mutex.Unlock()
+
+		metricsHub.finish(jobName)
+		logs.Close(jobName)
+	}()
+}
+
+// resync starts the collectors of unfinished jobs periodically, it covers the jobs
+// which were created before the server started.
+func (m *collectorManager) resync() {
+	for {
+		jobList, err := jobs.listJobs()
+		if err != nil {
+			logrus.Errorf("list jobs for collecting failed, err:%s", err.Error())
+		} else {
+			for _, job := range jobList {
+				if !isTerminalStatus(jobStatus(job)) {
+					m.start(job.Name)
+				}
+			}
+		}
+
+		time.Sleep(resyncInterval)
+	}
+}
+
+// collectJob collects the logs of the pods of job at the same time, so the logs of every
+// rank of a multi-node job are archived while they are running.
+func collectJob(jobName string) {
+	archive, err := newJobArchive(jobName)
+	if err != nil {
+		logrus.Errorf("read archived logs of job %s failed, err:%s", jobName, err.Error())
+
+		return
+	}
+
+	var (
+		wg    sync.WaitGroup
+		mutex sync.Mutex
+		// the pods which are being collected or have been collected
+		collecting = map[string]bool{}
+		done       = map[string]bool{}
+	)
+	defer wg.Wait()
+
+	for {
+		job, err := getJob(jobName)
+		if err != nil {
+			if !isNotFound(err) {
+				logrus.Errorf("get job %s for collecting failed, err:%s", jobName, err.Error())
+			}
+
+			return
+		}
+
+		pods, err := jobs.listPods(jobName)
+		if err != nil {
+			logrus.Errorf("list pods of job %s failed, err:%s", jobName, err.Error())
+			jobs.waitChange(collectInterval)
+
+			continue
+		}
+
+		allDone := true
+		sorted := sortPods(pods)
+		attempts := podAttempts(sorted)
+
+		mutex.Lock()
+		for _, pod := range sorted {
+			if done[pod.Name] {
+				continue
+			}
+			allDone = false
+
+			if collecting[pod.Name] || pod.Status.Phase == corev1.PodPending || pod.Status.Phase == corev1.PodUnknown {
+				continue
+			}
+			collecting[pod.Name] = true
+
+			wg.Add(1)
+			go func(pod *corev1.Pod, attempt int) {
+				defer wg.Done()
+
+				err := collectPod(archive, job, pod, attempt)
+				if err != nil {
+					logrus.Errorf("collect logs of pod %s failed, err:%s", pod.Name, err.Error())
+				}
+
+				mutex.Lock()
+				// the pod failed to be collected is collected again in the next round
+				delete(collecting, pod.Name)
+				done[pod.Name] = err == nil
+				mutex.Unlock()
+			}(pod, attempts[pod.Name])
+		}
+		mutex.Unlock()
+
+		if allDone && isTerminalStatus(jobStatus(job)) {
+			return
+		}
+
+		jobs.waitChange(collectInterval)
+	}
+}
+
+// collectPod archives the logs of pod which are not archived yet, so the collector
+// which is restarted doesn't archive the same lines again.
+func collectPod(archive *jobArchive, job *batchv1.Job, pod *corev1.Pod, attempt int) error {
+	cl, err := clusterOf(job)
+	if err != nil {
+		return err
+	}
+
+	// the timestamps are archived with the logs so that they can be filtered by time
+	req := cl.clientset.CoreV1().Pods(cl.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+		Follow:     true,
+		Timestamps: true,
+		SinceTime:  archive.since(pod.Name),
+	})
+
+	stream, err := req.Stream(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	archive.start(pod.Name, attempt)
+
+	rank := podRank(pod)
+
+	r := bufio.NewReader(stream)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			archive.write(pod.Name, attempt, bytes.TrimRight(line, "\r\n"), rank == 0)
+		}
+
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return err
+		}
+	}
+}
+
+// handleLogLine archives the line, the metrics are parsed from the logs of rank 0 only
+// because every rank of a multi-node job prints the same metrics.
+func handleLogLine(jobName string, line []byte, parseMetrics bool) {
+	if parseMetrics {
+		// the metric is at the time when it is printed, the line is collected later
+		t, content, ok := splitTimestamp(line)
+		if !ok {
+			t = time.Now()
+		}
+		handleMetricLine(jobName, content, t)
+	}
+
+	if err := logs.Write(jobName, line); err != nil {
+		logrus.Errorf("archive logs of job %s failed, err:%s", jobName, err.Error())
+	}
+}
+
+// jobArchive writes the logs of the pods of a job to the archive. It remembers the
+// timestamp of the last archived line of every pod, the lines which are not after it
+// have been archived already.
+type jobArchive struct {
+	jobName string
+
+	mutex sync.Mutex
+	// current is the pod whose segment marker is the last one in the archive
+	current string
+	last    map[string]time.Time
+	// buf is the incomplete line when the archive is scanned
+	buf []byte
+}
+
+func newJobArchive(jobName string) (*jobArchive, error) {
+	a := &jobArchive{
+		jobName: jobName,
+		last:    map[string]time.Time{},
+	}
+
+	if !logs.Exists(jobName) {
+		return a, nil
+	}
+
+	if err := logs.Read(jobName, &logReadOption{}, a); err != nil {
+		return nil, err
+	}
+	a.buf = nil
+
+	return a, nil
+}
+
+// Write scans the archived logs for the last timestamp of every pod
+func (a *jobArchive) Write(b []byte) (int, error) {
+	a.buf = append(a.buf, b...)
+
+	for {
+		i := bytes.IndexByte(a.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := a.buf[:i]
+		a.buf = a.buf[i+1:]
+
+		if pod, _, ok := parseSegmentMarker(line); ok {
+			a.current = pod
+
+			continue
+		}
+
+		if t, _, ok := splitTimestamp(line); ok && a.current != "" && t.After(a.last[a.current]) {
+			a.last[a.current] = t
+		}
+	}
+
+	return len(b), nil
+}
+
+// since returns the time from which the logs of pod are read, nil if none of them is archived
+func (a *jobArchive) since(pod string) *metav1.Time {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	t, ok := a.last[pod]
+	if !ok {
+		return nil
+	}
+
+	// the time is truncated to seconds by the api, so the lines in the same second are read again
+	return &metav1.Time{Time: t}
+}
+
+// start writes the segment marker of pod before its logs unless they are still the current ones
+func (a *jobArchive) start(pod string, attempt int) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.switchTo(pod, attempt)
+}
+
+func (a *jobArchive) switchTo(pod string, attempt int) {
+	if a.current == pod {
+		return
+	}
+
+	if err := logs.Write(a.jobName, segmentMarkerLine(pod, attempt)); err != nil {
+		logrus.Errorf("archive logs of job %s failed, err:%s", a.jobName, err.Error())
+	}
+	a.current = pod
+}
+
+// write archives the line of pod unless it has been archived
+func (a *jobArchive) write(pod string, attempt int, line []byte, parseMetrics bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	t, _, ok := splitTimestamp(line)
+	if ok {
+		if last, archived := a.last[pod]; archived && !t.After(last) {
+			return
+		}
+		a.last[pod] = t
+	}
+
+	a.switchTo(pod, attempt)
+	handleLogLine(a.jobName, line, parseMetrics)
+}
@@ -0,0 +1,333 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	defaultTemplateName = "default"
+	defaultNPUResource  = "huawei.com/Ascend910"
+	defaultNPUNumber    = 4
+	defaultMountPath    = "/opt"
+	defaultOutputPath   = "/output"
+	defaultResumePath   = "/resume"
+)
+
+var defaultCommand = []string{"/bin/bash", "-i", "/root/run_finetune.sh"}
+
+// Config
+type Config struct {
+	// Kubeconfig is the only cluster if Clusters is empty, Namespace is the default namespace of clusters
+	Kubeconfig      string            `json:"kubeconfig"`
+	Namespace       string            `json:"namespace"`
+	Clusters        []ClusterConfig   `json:"clusters"`
+	Placement       PlacementConfig   `json:"placement"`
+	Tokens          string            `json:"token_file"`
+	Image           string            `json:"image"`
+	DefaultTemplate string            `json:"default_template"`
+	Templates       []JobTemplate     `json:"templates"`
+	Dataset         DatasetConfig     `json:"dataset"`
+	Models          []BaseModel       `json:"models"`
+	Volumes         VolumeConfig      `json:"volumes"`
+	Artifact        ArtifactConfig    `json:"artifact"`
+	Worker          WorkerTemplate    `json:"worker"`
+	Metrics         MetricsConfig     `json:"metrics"`
+	Logs            LogsConfig        `json:"logs"`
+	Cancel          CancelConfig      `json:"cancel"`
+	Queue           QueueConfig       `json:"queue"`
+	Scheduler       SchedulerConfig   `json:"scheduler"`
+	Distributed     DistributedConfig `json:"distributed"`
+	Sweep           SweepConfig       `json:"sweep"`
+	Eval            EvalConfig        `json:"eval"`
+	Webhook         WebhookConfig     `json:"webhook"`
+	Retention       RetentionConfig   `json:"retention"`
+}
+
+func (cfg *Config) SetDefault() {
+	if len(cfg.Clusters) == 0 {
+		cfg.Clusters = []ClusterConfig{{
+			Name:       defaultClusterName,
+			Kubeconfig: cfg.Kubeconfig,
+		}}
+	}
+
+	for i := range cfg.Clusters {
+		cfg.Clusters[i].setDefault(cfg.Namespace)
+	}
+
+	cfg.Placement.setDefault()
+
+	if len(cfg.Templates) == 0 {
+		cfg.Templates = []JobTemplate{{Name: defaultTemplateName}}
+	}
+
+	for i := range cfg.Templates {
+		cfg.Templates[i].setDefault(cfg.Image)
+	}
+
+	if cfg.DefaultTemplate == "" {
+		cfg.DefaultTemplate = cfg.Templates[0].Name
+	}
+
+	cfg.Dataset.setDefault()
+
+	for i := range cfg.Models {
+		cfg.Models[i].setDefault()
+	}
+
+	cfg.Volumes.setDefault(cfg.Dataset.Dir)
+	cfg.Artifact.setDefault()
+	cfg.Worker.setDefault()
+	cfg.Metrics.setDefault()
+	cfg.Logs.setDefault()
+	cfg.Cancel.setDefault()
+	cfg.Queue.setDefault()
+	cfg.Scheduler.setDefault()
+	cfg.Distributed.setDefault()
+	cfg.Sweep.setDefault()
+	cfg.Eval.setDefault(cfg.Image)
+	cfg.Webhook.setDefault()
+	cfg.Retention.setDefault()
+}
+
+func (cfg *Config) Validate() error {
+	if err := cfg.validateClusters(); err != nil {
+		return err
+	}
+
+	names := make(map[string]bool, len(cfg.Templates))
+	for i := range cfg.Templates {
+		t := &cfg.Templates[i]
+
+		if err := t.validate(); err != nil {
+			return err
+		}
+
+		if names[t.Name] {
+			return fmt.Errorf("duplicate finetune template: %s", t.Name)
+		}
+		names[t.Name] = true
+	}
+
+	if !names[cfg.DefaultTemplate] {
+		return fmt.Errorf("default finetune template %s is not defined", cfg.DefaultTemplate)
+	}
+
+	if err := cfg.Dataset.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.validateModels(names); err != nil {
+		return err
+	}
+
+	if err := cfg.Volumes.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.validateSharedStorage(); err != nil {
+		return err
+	}
+
+	if err := cfg.Worker.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Metrics.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Logs.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Queue.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Eval.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Retention.validate(); err != nil {
+		return err
+	}
+
+	return cfg.Scheduler.validate()
+}
+
+func (cfg *Config) validateClusters() error {
+	// the kubeconfig is ignored if the clusters are set, so it must be set in the clusters
+	if cfg.Kubeconfig != "" && (len(cfg.Clusters) > 1 || cfg.Clusters[0].Kubeconfig != cfg.Kubeconfig) {
+		return errors.New("kubeconfig of finetune can't be set with clusters, set it in the clusters instead")
+	}
+
+	names := make(map[string]bool, len(cfg.Clusters))
+	for i := range cfg.Clusters {
+		c := &cfg.Clusters[i]
+
+		if err := c.validate(); err != nil {
+			return err
+		}
+
+		if names[c.Name] {
+			return fmt.Errorf("duplicate finetune cluster: %s", c.Name)
+		}
+		names[c.Name] = true
+	}
+
+	return cfg.Placement.validate()
+}
+
+// validateSharedStorage checks the storage of multiple clusters. The server reads the datasets,
+// artifacts, checkpoints and evaluation results from the dataset and artifact dirs, so the dataset
+// and output volumes of every cluster must be the claims bound to the storage mounted on them.
+func (cfg *Config) validateSharedStorage() error {
+	if len(cfg.Clusters) < 2 {
+		return nil
+	}
+
+	if cfg.Volumes.Dataset.ClaimName == "" {
+		return errors.New("dataset volume must be a claim of the shared storage when running in multiple clusters")
+	}
+
+	if !cfg.Volumes.Output.isEmpty() && cfg.Volumes.Output.ClaimName == "" {
+		return errors.New("output volume must be a claim of the shared storage when running in multiple clusters")
+	}
+
+	return nil
+}
+
+func (cfg *Config) validateModels(templates map[string]bool) error {
+	if len(cfg.Models) == 0 {
+		return errors.New("missing finetune models")
+	}
+
+	names := make(map[string]bool, len(cfg.Models))
+	for i := range cfg.Models {
+		m := &cfg.Models[i]
+
+		if err := m.validate(templates); err != nil {
+			return err
+		}
+
+		if names[m.Name] {
+			return fmt.Errorf("duplicate finetune model: %s", m.Name)
+		}
+		names[m.Name] = true
+	}
+
+	return nil
+}
+
+// JobTemplate describes how to run a finetune job for a base model or a training method
+type JobTemplate struct {
+	Name    string   `json:"name"    required:"true"`
+	Model   string   `json:"model"`
+	Method  string   `json:"method"`
+	Image   string   `json:"image"`
+	Command []string `json:"command"`
+	// Parameters are the default hyperparameters, they can be overridden by the job
+	Parameters map[string]string `json:"parameters"`
+	// Schema declares the hyperparameters which the job can set
+	Schema    []ParameterSchema `json:"schema"`
+	Resources TemplateResources `json:"resources"`
+	Mounts    TemplateMounts    `json:"mounts"`
+}
+
+func (t *JobTemplate) setDefault(image string) {
+	if t.Image == "" {
+		t.Image = image
+	}
+
+	if len(t.Command) == 0 {
+		t.Command = defaultCommand
+	}
+
+	t.Resources.setDefault()
+	t.Mounts.setDefault()
+}
+
+func (t *JobTemplate) validate() error {
+	if t.Name == "" {
+		return errors.New("missing finetune template name")
+	}
+
+	if t.Image == "" {
+		return fmt.Errorf("missing image of finetune template %s", t.Name)
+	}
+
+	if err := t.validateSchema(); err != nil {
+		return err
+	}
+
+	return t.Resources.validate()
+}
+
+// TemplateResources
+type TemplateResources struct {
+	NPU         int    `json:"npu"`
+	NPUResource string `json:"npu_resource"`
+	CPU         string `json:"cpu"`
+	Memory      string `json:"memory"`
+	// Nodes is the number of nodes of the data-parallel job, NPU is the number on every node
+	Nodes int `json:"nodes"`
+}
+
+func (r *TemplateResources) setDefault() {
+	if r.NPU <= 0 {
+		r.NPU = defaultNPUNumber
+	}
+
+	if r.NPUResource == "" {
+		r.NPUResource = defaultNPUResource
+	}
+
+	if r.Nodes <= 0 {
+		r.Nodes = 1
+	}
+}
+
+func (r *TemplateResources) validate() error {
+	for _, v := range []string{r.CPU, r.Memory} {
+		if v == "" {
+			continue
+		}
+
+		if _, err := resource.ParseQuantity(v); err != nil {
+			return fmt.Errorf("invalid resource quantity %s, err:%s", v, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// TemplateMounts is the directories in the container where the model and dataset are mounted
+type TemplateMounts struct {
+	ModelDir   string `json:"model_dir"`
+	DatasetDir string `json:"dataset_dir"`
+	OutputDir  string `json:"output_dir"`
+	// ResumeDir is where the checkpoint to resume from is mounted
+	ResumeDir string `json:"resume_dir"`
+}
+
+func (m *TemplateMounts) setDefault() {
+	if m.ModelDir == "" {
+		m.ModelDir = defaultMountPath
+	}
+
+	if m.DatasetDir == "" {
+		m.DatasetDir = defaultMountPath
+	}
+
+	if m.OutputDir == "" {
+		m.OutputDir = defaultOutputPath
+	}
+
+	if m.ResumeDir == "" {
+		m.ResumeDir = defaultResumePath
+	}
+}
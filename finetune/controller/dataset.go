@@ -0,0 +1,456 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/opensourceways/foundation-model-server/allerror"
+	commonctl "github.com/opensourceways/foundation-model-server/common/controller"
+	"github.com/opensourceways/foundation-model-server/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	datasetFormatJSON  = "json"
+	datasetFormatJSONL = "jsonl"
+
+	roleHuman  = "human"
+	roleGPT    = "gpt"
+	roleSystem = "system"
+)
+
+var (
+	datasets   datasetStore
+	datasetCfg DatasetConfig
+)
+
+// DatasetInfo
+type DatasetInfo struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Username  string `json:"username"`
+	Format    string `json:"format"`
+	Size      int64  `json:"size"`
+	Records   int    `json:"records"`
+	CreatedAt string `json:"created_at"`
+	// Owner is the hash of token which uploaded the dataset, it is not returned
+	Owner string `json:"owner,omitempty"`
+}
+
+// DatasetDetail is the dataset with some records of it
+type DatasetDetail struct {
+	DatasetInfo
+
+	Sample []json.RawMessage `json:"sample" swaggertype:"array,object"`
+}
+
+// datasetStore saves the datasets which are referenced by the finetune jobs
+type datasetStore interface {
+	Save(info *DatasetInfo, records []json.RawMessage) error
+	Get(id string) (DatasetInfo, error)
+	List() ([]DatasetInfo, error)
+	Sample(id string, n int) ([]json.RawMessage, error)
+	Delete(id string) error
+}
+
+// DatasetConfig
+type DatasetConfig struct {
+	Dir        string `json:"dir"`
+	MaxSize    int64  `json:"max_size"`
+	MinRecords int    `json:"min_records"`
+	MaxRecords int    `json:"max_records"`
+	SampleSize int    `json:"sample_size"`
+	MaxNameLen int    `json:"max_name_length"`
+}
+
+func (cfg *DatasetConfig) setDefault() {
+	if cfg.Dir == "" {
+		cfg.Dir = "/data/disk1/dataset"
+	}
+
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = 100 << 20
+	}
+
+	if cfg.MinRecords <= 0 {
+		cfg.MinRecords = 1
+	}
+
+	if cfg.MaxRecords <= 0 {
+		cfg.MaxRecords = 100000
+	}
+
+	if cfg.SampleSize <= 0 {
+		cfg.SampleSize = 5
+	}
+
+	if cfg.MaxNameLen <= 0 {
+		cfg.MaxNameLen = 64
+	}
+}
+
+func (cfg *DatasetConfig) validate() error {
+	if cfg.MinRecords > cfg.MaxRecords {
+		return errors.New("min_records of dataset must not be greater than max_records")
+	}
+
+	return nil
+}
+
+type conversationTurn struct {
+	From  string `json:"from"`
+	Value string `json:"value"`
+}
+
+type conversationRecord struct {
+	ID            string             `json:"id"`
+	Conversations []conversationTurn `json:"conversations"`
+}
+
+func (r *conversationRecord) validate() error {
+	if len(r.Conversations) == 0 {
+		return errors.New("empty conversations")
+	}
+
+	human, gpt := false, false
+	for i := range r.Conversations {
+		turn := &r.Conversations[i]
+
+		switch turn.From {
+		case roleHuman:
+			human = true
+		case roleGPT:
+			gpt = true
+		case roleSystem:
+		default:
+			return fmt.Errorf("unknown role: %s", turn.From)
+		}
+
+		if turn.Value == "" {
+			return errors.New("empty value of conversation")
+		}
+	}
+
+	if !human || !gpt {
+		return errors.New("conversations must contain both human and gpt turns")
+	}
+
+	return nil
+}
+
+// parseDataset parses the content of JSON array or JSON lines and checks every record of it
+func parseDataset(content []byte, cfg *DatasetConfig) (format string, records []json.RawMessage, err error) {
+	content = bytes.TrimSpace(content)
+
+	if bytes.HasPrefix(content, []byte("[")) {
+		format = datasetFormatJSON
+
+		if err = json.Unmarshal(content, &records); err != nil {
+			err = fmt.Errorf("invalid json: %s", err.Error())
+
+			return
+		}
+	} else {
+		format = datasetFormatJSONL
+
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		scanner.Buffer(make([]byte, 0, 64*1024), len(content)+1)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+
+			records = append(records, json.RawMessage(append([]byte(nil), line...)))
+		}
+
+		if err = scanner.Err(); err != nil {
+			return
+		}
+	}
+
+	if n := len(records); n < cfg.MinRecords || n > cfg.MaxRecords {
+		err = fmt.Errorf(
+			"the number of records must be between %d and %d, but got %d",
+			cfg.MinRecords, cfg.MaxRecords, n,
+		)
+
+		return
+	}
+
+	for i, item := range records {
+		var r conversationRecord
+		if err = json.Unmarshal(item, &r); err != nil {
+			err = fmt.Errorf("record %d: invalid json: %s", i+1, err.Error())
+
+			return
+		}
+
+		if err = r.validate(); err != nil {
+			err = fmt.Errorf("record %d: %s", i+1, err.Error())
+
+			return
+		}
+	}
+
+	return
+}
+
+// checkDatasetExists checks whether the dataset referenced by a job is registered
+func checkDatasetExists(id string) error {
+	_, err := datasets.Get(id)
+	if _, ok := err.(interface{ NotFound() }); ok {
+		return allerror.New(allerror.ErrorBadRequestParam, fmt.Sprintf("unknown dataset: %s", id))
+	}
+
+	return err
+}
+
+// checkDatasetPerm checks whether the dataset is uploaded by the token, the datasets
+// whose owner is unknown can't be managed by any token.
+func checkDatasetPerm(id, secret string) error {
+	info, err := datasets.Get(id)
+	if err != nil {
+		return err
+	}
+
+	if info.Owner == "" {
+		return allerror.New(allerror.ErrorPermissionDeny, "Permission denied, the owner of dataset is unknown")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(info.Owner), []byte(ownerHash(secret))) != 1 {
+		return allerror.New(allerror.ErrorPermissionDeny, "Permission denied, you can't delete datasets uploaded by others")
+	}
+
+	return nil
+}
+
+// checkDatasetUnused checks the dataset is not referenced by the jobs which are not finished
+// or the running sweeps, they need it to create or retry the jobs.
+func checkDatasetUnused(id string) error {
+	items, err := jobs.listJobs()
+	if err != nil {
+		return err
+	}
+
+	for _, job := range items {
+		if job.Labels["data"] == id && !isTerminalStatus(jobStatus(job)) {
+			return allerror.New(allerror.ErrorBadRequestParam, fmt.Sprintf("dataset %s is used by job %s", id, job.Name))
+		}
+	}
+
+	v, err := sweeps.store.List()
+	if err != nil {
+		return err
+	}
+
+	for i := range v {
+		if v[i].Base.Dataset == id && v[i].Status == sweepRunning {
+			return allerror.New(allerror.ErrorBadRequestParam, fmt.Sprintf("dataset %s is used by sweep %s", id, v[i].ID))
+		}
+	}
+
+	return nil
+}
+
+func checkFinetuneToken(c *gin.Context) error {
+	secret := c.GetHeader(headerSecret)
+	if secret == "" {
+		return allerror.New(allerror.ErrorPermissionDeny, "Permission denied, empty finetune token")
+	}
+
+	if !validFinetuneToken(secret) {
+		return allerror.New(allerror.ErrorPermissionDeny, "Permission denied, invalid finetune token")
+	}
+
+	return nil
+}
+
+// @Summary		Upload
+// @Description	upload a dataset of JSON or JSON lines
+// @Tags			Finetune
+// @Param			name		formData	string	true	"dataset name"
+// @Param			username	formData	string	true	"owner of dataset"
+// @Param			file		formData	file	true	"dataset file"
+// @Accept			multipart/form-data
+// @Success		200	{object}		DatasetInfo
+// @Failure		500	system_error	system	error
+// @Router			/v1/finetune/datasets [post]
+func uploadDataset(c *gin.Context) {
+	if err := checkFinetuneToken(c); err != nil {
+		logrus.Error(err)
+		commonctl.SendFailedResp(c, err)
+		return
+	}
+
+	name := c.PostForm("name")
+	username := c.PostForm("username")
+	if name == "" || username == "" || utils.StrLen(name) > datasetCfg.MaxNameLen {
+		err := fmt.Errorf("invalid dataset name or username")
+		logrus.Error(err)
+		commonctl.SendBadRequestParam(c, err)
+		return
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		logrus.Error(err)
+		commonctl.SendBadRequestParam(c, err)
+		return
+	}
+
+	if fh.Size > datasetCfg.MaxSize {
+		err := fmt.Errorf("dataset is too large, the max size is %d bytes", datasetCfg.MaxSize)
+		logrus.Error(err)
+		commonctl.SendBadRequestParam(c, err)
+		return
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		logrus.Error(err)
+		commonctl.SendFailedResp(c, err)
+		return
+	}
+	defer f.Close()
+
+	content, err := io.ReadAll(io.LimitReader(f, datasetCfg.MaxSize+1))
+	if err != nil {
+		logrus.Error(err)
+		commonctl.SendFailedResp(c, err)
+		return
+	}
+
+	if int64(len(content)) > datasetCfg.MaxSize {
+		err := fmt.Errorf("dataset is too large, the max size is %d bytes", datasetCfg.MaxSize)
+		logrus.Error(err)
+		commonctl.SendBadRequestParam(c, err)
+		return
+	}
+
+	format, records, err := parseDataset(content, &datasetCfg)
+	if err != nil {
+		logrus.Error(err)
+		commonctl.SendBadRequestBody(c, err)
+		return
+	}
+
+	info := DatasetInfo{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Username:  username,
+		Format:    format,
+		Size:      int64(len(content)),
+		Records:   len(records),
+		CreatedAt: time.Now().Format(time.RFC3339),
+		Owner:     ownerHash(c.GetHeader(headerSecret)),
+	}
+
+	if err := datasets.Save(&info, records); err != nil {
+		logrus.Error(err)
+		commonctl.SendFailedResp(c, err)
+		return
+	}
+
+	info.Owner = ""
+	c.JSON(http.StatusOK, info)
+}
+
+// @Summary		List
+// @Description	list datasets
+// @Tags			Finetune
+// @Success		200	{object}		[]DatasetInfo
+// @Failure		500	system_error	system	error
+// @Router			/v1/finetune/datasets [get]
+func listDatasets(c *gin.Context) {
+	v, err := datasets.List()
+	if err != nil {
+		logrus.Error(err)
+		commonctl.SendFailedResp(c, err)
+		return
+	}
+
+	for i := range v {
+		v[i].Owner = ""
+	}
+
+	c.JSON(http.StatusOK, v)
+}
+
+// @Summary		Get
+// @Description	get a dataset with a sample of its records
+// @Tags			Finetune
+// @Param			id	path	string	true	"dataset id"
+// @Success		200	{object}		DatasetDetail
+// @Failure		500	system_error	system	error
+// @Router			/v1/finetune/datasets/{id} [get]
+func getDataset(c *gin.Context) {
+	id := c.Param("id")
+
+	info, err := datasets.Get(id)
+	if err != nil {
+		logrus.Error(err)
+		commonctl.SendFailedResp(c, err)
+		return
+	}
+
+	sample, err := datasets.Sample(id, datasetCfg.SampleSize)
+	if err != nil {
+		logrus.Error(err)
+		commonctl.SendFailedResp(c, err)
+		return
+	}
+
+	info.Owner = ""
+	c.JSON(http.StatusOK, DatasetDetail{
+		DatasetInfo: info,
+		Sample:      sample,
+	})
+}
+
+// @Summary		Delete
+// @Description	delete a dataset
+// @Tags			Finetune
+// @Param			id	path	string	true	"dataset id"
+// @Success		200
+// @Failure		500	system_error	system	error
+// @Router			/v1/finetune/datasets/{id} [delete]
+func deleteDataset(c *gin.Context) {
+	if err := checkFinetuneToken(c); err != nil {
+		logrus.Error(err)
+		commonctl.SendFailedResp(c, err)
+		return
+	}
+
+	id := c.Param("id")
+	if err := checkDatasetPerm(id, c.GetHeader(headerSecret)); err != nil {
+		logrus.Error(err)
+		commonctl.SendFailedResp(c, err)
+		return
+	}
+
+	if err := checkDatasetUnused(id); err != nil {
+		logrus.Error(err)
+		commonctl.SendFailedResp(c, err)
+		return
+	}
+
+	if err := datasets.Delete(id); err != nil {
+		logrus.Error(err)
+		commonctl.SendFailedResp(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"msg": fmt.Sprintf("Dataset %s deleted", id),
+	})
+}
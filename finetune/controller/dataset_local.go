@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/opensourceways/foundation-model-server/allerror"
+)
+
+const (
+	datasetFileSuffix = ".json"
+	datasetMetaSuffix = ".meta.json"
+)
+
+// localDatasetStore saves every dataset as a JSON array file with a metadata file beside it
+type localDatasetStore struct {
+	dir string
+}
+
+func newLocalDatasetStore(dir string) (*localDatasetStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &localDatasetStore{dir: dir}, nil
+}
+
+func (s *localDatasetStore) dataFile(id string) string {
+	return filepath.Join(s.dir, id+datasetFileSuffix)
+}
+
+func (s *localDatasetStore) metaFile(id string) string {
+	return filepath.Join(s.dir, id+datasetMetaSuffix)
+}
+
+func (s *localDatasetStore) checkID(id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return allerror.New(allerror.ErrorBadRequestParam, fmt.Sprintf("invalid dataset: %s", id))
+	}
+
+	return nil
+}
+
+func (s *localDatasetStore) Save(info *DatasetInfo, records []json.RawMessage) error {
+	if err := s.checkID(info.ID); err != nil {
+		return err
+	}
+
+	err := writeFileAtomic(s.dataFile(info.ID), func(w *bufio.Writer) error {
+		if err := w.WriteByte('['); err != nil {
+			return err
+		}
+
+		for i, r := range records {
+			if i > 0 {
+				if _, err := w.WriteString(",\n"); err != nil {
+					return err
+				}
+			}
+
+			if _, err := w.Write(r); err != nil {
+				return err
+			}
+		}
+
+		return w.WriteByte(']')
+	})
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.metaFile(info.ID), func(w *bufio.Writer) error {
+		_, err := w.Write(b)
+
+		return err
+	})
+}
+
+func (s *localDatasetStore) Get(id string) (info DatasetInfo, err error) {
+	if err = s.checkID(id); err != nil {
+		return
+	}
+
+	b, err := os.ReadFile(s.metaFile(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = allerror.NewNotFound(fmt.Sprintf("dataset %s not found", id))
+		}
+
+		return
+	}
+
+	err = json.Unmarshal(b, &info)
+
+	return
+}
+
+func (s *localDatasetStore) List() ([]DatasetInfo, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*"+datasetMetaSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	r := make([]DatasetInfo, 0, len(files))
+	for _, f := range files {
+		info, err := s.Get(strings.TrimSuffix(filepath.Base(f), datasetMetaSuffix))
+		if err != nil {
+			return nil, err
+		}
+
+		r = append(r, info)
+	}
+
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].CreatedAt > r[j].CreatedAt
+	})
+
+	return r, nil
+}
+
+func (s *localDatasetStore) Sample(id string, n int) ([]json.RawMessage, error) {
+	if _, err := s.Get(id); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(s.dataFile(id))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(f))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	r := make([]json.RawMessage, 0, n)
+	for len(r) < n && dec.More() {
+		var item json.RawMessage
+		if err := dec.Decode(&item); err != nil {
+			return nil, err
+		}
+
+		r = append(r, item)
+	}
+
+	return r, nil
+}
+
+func (s *localDatasetStore) Delete(id string) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+
+	if err := os.Remove(s.metaFile(id)); err != nil {
+		return err
+	}
+
+	if err := os.Remove(s.dataFile(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// writeFileAtomic writes to a temporary file and renames it to the target
+func writeFileAtomic(path string, write func(*bufio.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-"+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	w := bufio.NewWriter(f)
+	if err := write(w); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestParseDataset(t *testing.T) {
+	cfg := DatasetConfig{MinRecords: 1, MaxRecords: 2}
+
+	record := `{"id":"1","conversations":[{"from":"human","value":"hi"},{"from":"gpt","value":"hello"}]}`
+
+	cases := []struct {
+		name        string
+		content     string
+		wantFormat  string
+		wantRecords int
+		wantErr     bool
+	}{
+		{"json", "[" + record + "," + record + "]", datasetFormatJSON, 2, false},
+		{"json lines with blank lines", record + "\n\n" + record + "\n", datasetFormatJSONL, 2, false},
+		{"invalid json", "[" + record, datasetFormatJSON, 0, true},
+		{"too few records", "[]", datasetFormatJSON, 0, true},
+		{"too many records", record + "\n" + record + "\n" + record, datasetFormatJSONL, 3, true},
+		{"invalid record", `{"id":"1"`, datasetFormatJSONL, 1, true},
+		{"no gpt turn", `{"conversations":[{"from":"human","value":"hi"}]}`, datasetFormatJSONL, 1, true},
+		{"unknown role", `{"conversations":[{"from":"human","value":"hi"},{"from":"bot","value":"x"}]}`, datasetFormatJSONL, 1, true},
+		{"empty value", `{"conversations":[{"from":"human","value":""},{"from":"gpt","value":"x"}]}`, datasetFormatJSONL, 1, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			format, records, err := parseDataset([]byte(tc.content), &cfg)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if format != tc.wantFormat {
+				t.Errorf("format = %s, want %s", format, tc.wantFormat)
+			}
+
+			if !tc.wantErr && len(records) != tc.wantRecords {
+				t.Errorf("got %d records, want %d", len(records), tc.wantRecords)
+			}
+		})
+	}
+}
+
+func TestCheckDatasetPerm(t *testing.T) {
+	store, err := newLocalDatasetStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := datasets
+	datasets = store
+	defer func() { datasets = old }()
+
+	owned := DatasetInfo{ID: uuid.New().String(), Owner: ownerHash("token")}
+	unowned := DatasetInfo{ID: uuid.New().String()}
+
+	for _, info := range []*DatasetInfo{&owned, &unowned} {
+		if err := store.Save(info, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := checkDatasetPerm(owned.ID, "token"); err != nil {
+		t.Errorf("the owner is denied: %v", err)
+	}
+
+	if err := checkDatasetPerm(owned.ID, "other"); err == nil {
+		t.Error("another token is allowed")
+	}
+
+	// the dataset without owner is rejected the same as the artifacts without owner
+	if err := checkDatasetPerm(unowned.ID, "token"); err == nil {
+		t.Error("the dataset without owner is allowed")
+	}
+}
@@ -0,0 +1,390 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opensourceways/foundation-model-server/allerror"
+	commonctl "github.com/opensourceways/foundation-model-server/common/controller"
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+)
+
+const (
+	annotationServedModel = "finetune/served-model"
+	labelFinetuneJob      = "finetune-job"
+	labelServedModel      = "served-model"
+	workerPrefix          = "worker-"
+	statusComplete        = "Complete"
+)
+
+var (
+	workerCfg    WorkerTemplate
+	servedNameRe = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9._-]{0,61}[a-zA-Z0-9])?$`)
+)
+
+// WorkerTemplate describes the model worker which serves a finetuned model
+type WorkerTemplate struct {
+	Image   string   `json:"image"`
+	Command []string `json:"command"`
+	Args    []string `json:"args"`
+	// ControllerAddress is the address of the controller which the worker registers to
+	ControllerAddress string            `json:"controller_address"`
+	Port              int               `json:"port"`
+	Resources         TemplateResources `json:"resources"`
+	BaseModelDir      string            `json:"base_model_dir"`
+	OutputDir         string            `json:"output_dir"`
+}
+
+func (t *WorkerTemplate) setDefault() {
+	if len(t.Command) == 0 {
+		t.Command = []string{"python3", "-m", "fastchat.serve.model_worker"}
+	}
+
+	if len(t.Args) == 0 {
+		t.Args = []string{
+			"--model-path", "$(MODEL_PATH)",
+			"--model-names", "$(MODEL_NAME)",
+			"--controller-address", "$(CONTROLLER_ADDRESS)",
+			"--worker-address", "http://$(POD_IP):$(PORT)",
+			"--host", "0.0.0.0",
+			"--port", "$(PORT)",
+		}
+	}
+
+	if t.Port <= 0 {
+		t.Port = 21002
+	}
+
+	if t.BaseModelDir == "" {
+		t.BaseModelDir = "/base-model"
+	}
+
+	if t.OutputDir == "" {
+		t.OutputDir = "/model"
+	}
+
+	t.Resources.setDefault()
+}
+
+func (t *WorkerTemplate) validate() error {
+	// the worker is optional, it is disabled if the image is not set
+	if t.Image == "" {
+		return nil
+	}
+
+	if t.ControllerAddress == "" {
+		return errors.New("missing controller address of worker")
+	}
+
+	return t.Resources.validate()
+}
+
+func (t *WorkerTemplate) env(name string) []corev1.EnvVar {
+	return []corev1.EnvVar{
+		{Name: "MODEL_NAME", Value: name},
+		{Name: "MODEL_PATH", Value: t.OutputDir},
+		{Name: "BASE_MODEL_PATH", Value: t.BaseModelDir},
+		{Name: "CONTROLLER_ADDRESS", Value: t.ControllerAddress},
+		{Name: "PORT", Value: fmt.Sprint(t.Port)},
+		{
+			Name: "POD_IP",
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{FieldPath: "status.podIP"},
+			},
+		},
+	}
+}
+
+func workerName(jobName string) string {
+	return workerPrefix + jobName
+}
+
+// DeployRequest
+type DeployRequest struct {
+	ModelName string `json:"model_name" required:"true"`
+}
+
+func newWorkerDeployment(job *batchv1.Job, model *BaseModel, name string) (*appsv1.Deployment, error) {
+	modelPath, err := subPath(model.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := map[string]string{
+		labelFinetuneJob: job.Name,
+		labelServedModel: name,
+	}
+
+	resources := workerCfg.Resources
+	cl, err := clusterOf(job)
+	if err != nil {
+		return nil, err
+	}
+
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      workerName(job.Name),
+			Namespace: cl.Namespace,
+			Labels:    labels,
+			// the worker is deleted with the job
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(job, batchv1.SchemeGroupVersion.WithKind("Job")),
+			},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: pointer.Int32(1),
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:    "worker",
+							Image:   cl.image(workerCfg.Image),
+							Command: workerCfg.Command,
+							Args:    workerCfg.Args,
+							Env:     workerCfg.env(name),
+							Ports: []corev1.ContainerPort{
+								{ContainerPort: int32(workerCfg.Port)},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      volumeModel,
+									MountPath: workerCfg.BaseModelDir,
+									SubPath:   modelPath,
+									ReadOnly:  true,
+								},
+								{
+									Name:      volumeOutput,
+									MountPath: workerCfg.OutputDir,
+									SubPath:   job.Annotations[annotationOutput],
+									ReadOnly:  true,
+								},
+							},
+							Resources: corev1.ResourceRequirements{
+								Requests: resources.resourceList(),
+								Limits:   resources.resourceList(),
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						volumeCfg.Model.volume(volumeModel, true),
+						volumeCfg.Output.volume(volumeOutput, true),
+					},
+					NodeSelector: volumeCfg.NodeSelector,
+					Affinity:     volumeCfg.Affinity,
+				},
+			},
+		},
+	}, nil
+}
+
+// setServedModel records the model name served by the job, it is removed if name is empty
+func setServedModel(cl *cluster, jobName, name string) error {
+	var v interface{}
+	if name != "" {
+		v = name
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{annotationServedModel: v},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = cl.clientset.BatchV1().Jobs(cl.Namespace).Patch(
+		context.TODO(), jobName, types.MergePatchType, patch, metav1.PatchOptions{},
+	)
+
+	return err
+}
+
+// modelNameInUse checks whether the model name is served by a worker in any cluster
+func modelNameInUse(name string) (bool, error) {
+	for _, cl := range clusters {
+		workers, err := cl.clientset.AppsV1().Deployments(cl.Namespace).List(context.TODO(), metav1.ListOptions{
+			LabelSelector: labelServedModel + "=" + name,
+		})
+		if err != nil {
+			return false, err
+		}
+
+		if len(workers.Items) > 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func doDeployJob(jobName, name string) error {
+	if workerCfg.Image == "" || !hasOutputVolume() {
+		return allerror.New(allerror.ErrorFinetune, "deploying finetuned model is not enabled")
+	}
+
+	job, err := getJob(jobName)
+	if err != nil {
+		logrus.Error(err.Error())
+		return fmt.Errorf("get job info failed")
+	}
+
+	if jobStatus(job) != statusComplete || job.Annotations[annotationOutput] == "" {
+		return allerror.New(allerror.ErrorFinetune, "only the succeeded job can be deployed")
+	}
+
+	model, ok := models[job.Labels["model"]]
+	if !ok {
+		return allerror.New(allerror.ErrorFinetune, fmt.Sprintf("unknown model: %s", job.Labels["model"]))
+	}
+
+	inUse, err := modelNameInUse(name)
+	if err != nil {
+		logrus.Error(err.Error())
+		return fmt.Errorf("list workers failed")
+	}
+
+	if inUse {
+		return allerror.New(allerror.ErrorBadRequestParam, fmt.Sprintf("model name %s is in use", name))
+	}
+
+	deploy, err := newWorkerDeployment(job, model, name)
+	if err != nil {
+		return err
+	}
+
+	cl, err := clusterOf(job)
+	if err != nil {
+		logrus.Error(err.Error())
+		return fmt.Errorf("create worker failed")
+	}
+
+	if _, err = cl.clientset.AppsV1().Deployments(cl.Namespace).Create(context.TODO(), deploy, metav1.CreateOptions{}); err != nil {
+		logrus.Error(err.Error())
+		return fmt.Errorf("create worker failed")
+	}
+
+	if err := setServedModel(cl, jobName, name); err != nil {
+		logrus.Errorf("record served model of job %s failed, err:%s", jobName, err.Error())
+	}
+
+	return nil
+}
+
+// deleteWorker deletes the worker serving the model of job
+func deleteWorker(cl *cluster, jobName string) error {
+	return cl.clientset.AppsV1().Deployments(cl.Namespace).Delete(context.TODO(), workerName(jobName), metav1.DeleteOptions{})
+}
+
+func doUndeployJob(jobName string) error {
+	job, err := getJob(jobName)
+	if err != nil {
+		logrus.Error(err.Error())
+		return fmt.Errorf("get job info failed")
+	}
+
+	cl, err := clusterOf(job)
+	if err != nil {
+		logrus.Error(err.Error())
+		return fmt.Errorf("get job info failed")
+	}
+
+	if err = deleteWorker(cl, jobName); err != nil {
+		if isNotFound(err) {
+			return allerror.NewNotFound(fmt.Sprintf("job %s is not deployed", jobName))
+		}
+
+		logrus.Error(err.Error())
+		return fmt.Errorf("delete worker failed")
+	}
+
+	if err := setServedModel(cl, jobName, ""); err != nil && !isNotFound(err) {
+		logrus.Errorf("remove served model of job %s failed, err:%s", jobName, err.Error())
+	}
+
+	return nil
+}
+
+// @Summary		Deploy
+// @Description	deploy a finetuned model to the chat service
+// @Tags			Finetune
+// @Param			jobname	path	string			true	"finetune id"
+// @Param			body	body	DeployRequest	true	"body of deploying finetuned model"
+// @Accept			json
+// @Success		200
+// @Failure		500	system_error	system	error
+// @Router			/v1/job/{jobname}/deploy [post]
+func deployJob(c *gin.Context) {
+	jobName := c.Param("jobname")
+
+	var req DeployRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		commonctl.SendBadRequestBody(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	if !servedNameRe.MatchString(req.ModelName) {
+		err := fmt.Errorf("invalid model name")
+		commonctl.SendBadRequestBody(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	if err := checkJobPerm(jobName, c.GetHeader(headerSecret), "deploy"); err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	if err := doDeployJob(jobName, req.ModelName); err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"msg": fmt.Sprintf("Job %s deployed as %s", jobName, req.ModelName),
+	})
+}
+
+// @Summary		Undeploy
+// @Description	remove a finetuned model from the chat service
+// @Tags			Finetune
+// @Param			jobname	path	string	true	"finetune id"
+// @Accept			json
+// @Success		200
+// @Failure		500	system_error	system	error
+// @Router			/v1/job/{jobname}/deploy [delete]
+func undeployJob(c *gin.Context) {
+	jobName := c.Param("jobname")
+
+	if err := checkJobPerm(jobName, c.GetHeader(headerSecret), "undeploy"); err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	if err := doUndeployJob(jobName); err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"msg": fmt.Sprintf("Job %s undeployed", jobName),
+	})
+}
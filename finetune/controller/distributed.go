@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+const (
+	// servicePrefix makes the name of service start with a letter, the name of job is a uuid
+	servicePrefix = "ft-"
+
+	envMasterAddr   = "MASTER_ADDR"
+	envMasterPort   = "MASTER_PORT"
+	envNodeRank     = "NODE_RANK"
+	envNNodes       = "NNODES"
+	envWorldSize    = "WORLD_SIZE"
+	envNProcPerNode = "NPROC_PER_NODE"
+)
+
+var (
+	distributedCfg DistributedConfig
+
+	// distributedEnvs are the environments set for the multi-node jobs, they are not the parameters
+	distributedEnvs = []string{
+		envMasterAddr, envMasterPort, envNodeRank, envNNodes, envWorldSize, envNProcPerNode,
+	}
+)
+
+// DistributedConfig
+type DistributedConfig struct {
+	// MasterPort is the port of rendezvous on the pod of rank 0
+	MasterPort int `json:"master_port"`
+}
+
+func (cfg *DistributedConfig) setDefault() {
+	if cfg.MasterPort <= 0 {
+		cfg.MasterPort = 29500
+	}
+}
+
+func rendezvousService(jobName string) string {
+	return servicePrefix + jobName
+}
+
+// jobNodes returns the number of nodes which the job runs on
+func jobNodes(job *batchv1.Job) int {
+	if job.Spec.Parallelism == nil || *job.Spec.Parallelism < 1 {
+		return 1
+	}
+
+	return int(*job.Spec.Parallelism)
+}
+
+// podRank returns the rank of pod in the multi-node job, it is 0 for the single node job
+func podRank(pod *corev1.Pod) int {
+	n, _ := strconv.Atoi(pod.Annotations[batchv1.JobCompletionIndexAnnotation])
+
+	return n
+}
+
+// podAttempts returns the attempt of every pod, the pods of different ranks run at the same time
+func podAttempts(sorted []*corev1.Pod) map[string]int {
+	r := make(map[string]int, len(sorted))
+	ranks := map[int]int{}
+
+	for _, pod := range sorted {
+		rank := podRank(pod)
+		ranks[rank]++
+		r[pod.Name] = ranks[rank]
+	}
+
+	return r
+}
+
+// setupDistributed turns the job into an indexed job of which every pod runs on a node
+func setupDistributed(job *batchv1.Job, resources *TemplateResources) {
+	if resources.Nodes <= 1 {
+		return
+	}
+
+	nodes := int32(resources.Nodes)
+	job.Spec.CompletionMode = (*batchv1.CompletionMode)(pointer.String(string(batchv1.IndexedCompletion)))
+	job.Spec.Completions = pointer.Int32(nodes)
+	job.Spec.Parallelism = pointer.Int32(nodes)
+
+	spec := &job.Spec.Template.Spec
+	spec.Subdomain = rendezvousService(job.Name)
+
+	// the pod of rank 0 is resolved by the hostname of indexed job in the headless service
+	master := fmt.Sprintf("%s-0.%s", job.Name, spec.Subdomain)
+	world := strconv.Itoa(resources.Nodes * resources.NPU)
+
+	env := []corev1.EnvVar{
+		{Name: envMasterAddr, Value: master},
+		{Name: envMasterPort, Value: strconv.Itoa(distributedCfg.MasterPort)},
+		{Name: envNNodes, Value: strconv.Itoa(resources.Nodes)},
+		{Name: envNProcPerNode, Value: resources.npuNumber()},
+		{Name: envWorldSize, Value: world},
+		{
+			Name: envNodeRank,
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{
+					FieldPath: fmt.Sprintf("metadata.annotations['%s']", batchv1.JobCompletionIndexAnnotation),
+				},
+			},
+		},
+	}
+
+	for i := range spec.Containers {
+		spec.Containers[i].Env = append(spec.Containers[i].Env, env...)
+	}
+}
+
+// createRendezvousService creates the headless service by which the pods find each other,
+// the service is deleted with the job.
+func createRendezvousService(cl *cluster, job *batchv1.Job) error {
+	if job.Spec.Template.Spec.Subdomain == "" {
+		return nil
+	}
+
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      job.Spec.Template.Spec.Subdomain,
+			Namespace: cl.Namespace,
+			Labels:    map[string]string{labelJobName: job.Name},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(job, batchv1.SchemeGroupVersion.WithKind("Job")),
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP:                corev1.ClusterIPNone,
+			Selector:                 map[string]string{labelJobName: job.Name},
+			PublishNotReadyAddresses: true,
+			Ports: []corev1.ServicePort{{
+				Name: "rendezvous",
+				Port: int32(distributedCfg.MasterPort),
+			}},
+		},
+	}
+
+	_, err := cl.clientset.CoreV1().Services(cl.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+
+	return err
+}
+
+func deleteRendezvousService(cl *cluster, jobName string) error {
+	err := cl.clientset.CoreV1().Services(cl.Namespace).Delete(
+		context.TODO(), rendezvousService(jobName), metav1.DeleteOptions{},
+	)
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,610 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/opensourceways/foundation-model-server/allerror"
+	commonctl "github.com/opensourceways/foundation-model-server/common/controller"
+	"github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+)
+
+const (
+	annotationEvals       = "finetune/evals"
+	annotationEvalResults = "finetune/eval-results"
+	labelEvalOf           = "eval-of"
+	labelEvalSuite        = "eval-suite"
+
+	maxCompareJobs = 50
+)
+
+var evalCfg EvalConfig
+
+// EvalConfig
+type EvalConfig struct {
+	// Interval is the max seconds between two rounds of checking the evaluations
+	Interval int `json:"interval"`
+	// ScorePrefix is the prefix of log lines of scores, the rest of line is a JSON object of scores
+	ScorePrefix string `json:"score_prefix"`
+	// Suites are the evaluations which a job can declare to run after it succeeds
+	Suites []EvalSuite `json:"suites"`
+}
+
+func (cfg *EvalConfig) setDefault(image string) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 30
+	}
+
+	if cfg.ScorePrefix == "" {
+		cfg.ScorePrefix = "EVAL_SCORES:"
+	}
+
+	for i := range cfg.Suites {
+		cfg.Suites[i].setDefault(image)
+	}
+}
+
+func (cfg *EvalConfig) validate() error {
+	names := make(map[string]bool, len(cfg.Suites))
+	for i := range cfg.Suites {
+		s := &cfg.Suites[i]
+
+		if err := s.validate(); err != nil {
+			return err
+		}
+
+		if names[s.Name] {
+			return fmt.Errorf("duplicate eval suite: %s", s.Name)
+		}
+		names[s.Name] = true
+	}
+
+	return nil
+}
+
+func (cfg *EvalConfig) suite(name string) *EvalSuite {
+	for i := range cfg.Suites {
+		if cfg.Suites[i].Name == name {
+			return &cfg.Suites[i]
+		}
+	}
+
+	return nil
+}
+
+// EvalSuite is the template of job which evaluates the output of a succeeded finetune job
+type EvalSuite struct {
+	Name    string   `json:"name"    required:"true"`
+	Image   string   `json:"image"`
+	Command []string `json:"command" required:"true"`
+	Args    []string `json:"args"`
+	// Parameters are passed to the evaluation as the environments
+	Parameters   map[string]string `json:"parameters"`
+	Resources    TemplateResources `json:"resources"`
+	BaseModelDir string            `json:"base_model_dir"`
+	OutputDir    string            `json:"output_dir"`
+}
+
+func (s *EvalSuite) setDefault(image string) {
+	if s.Image == "" {
+		s.Image = image
+	}
+
+	if s.BaseModelDir == "" {
+		s.BaseModelDir = "/base-model"
+	}
+
+	if s.OutputDir == "" {
+		s.OutputDir = "/model"
+	}
+
+	s.Resources.setDefault()
+}
+
+func (s *EvalSuite) validate() error {
+	if s.Name == "" {
+		return errors.New("missing eval suite name")
+	}
+
+	if s.Image == "" {
+		return fmt.Errorf("missing image of eval suite %s", s.Name)
+	}
+
+	if len(s.Command) == 0 {
+		return fmt.Errorf("missing command of eval suite %s", s.Name)
+	}
+
+	return s.Resources.validate()
+}
+
+func (s *EvalSuite) env(model string) []corev1.EnvVar {
+	env := createEnvVars(&s.Parameters)
+
+	return append(env,
+		corev1.EnvVar{Name: "MODEL_NAME", Value: model},
+		corev1.EnvVar{Name: "MODEL_PATH", Value: s.OutputDir},
+		corev1.EnvVar{Name: "BASE_MODEL_PATH", Value: s.BaseModelDir},
+		corev1.EnvVar{Name: "EVAL_SUITE", Value: s.Name},
+	)
+}
+
+// EvalResult is the evaluation of a suite on the output of job
+type EvalResult struct {
+	JobName string             `json:"jobName,omitempty"`
+	Status  string             `json:"status"`
+	Scores  map[string]float64 `json:"scores,omitempty"`
+	Error   string             `json:"error,omitempty"`
+}
+
+// checkEvalSuites checks the suites declared by the job
+func checkEvalSuites(suites []string) error {
+	if len(suites) == 0 {
+		return nil
+	}
+
+	if !hasOutputVolume() {
+		return allerror.New(allerror.ErrorFinetune, "evaluation is not enabled without output volume")
+	}
+
+	names := make(map[string]bool, len(suites))
+	for _, v := range suites {
+		if evalCfg.suite(v) == nil {
+			return allerror.New(allerror.ErrorBadRequestParam, fmt.Sprintf("unknown eval suite: %s", v))
+		}
+
+		if names[v] {
+			return allerror.New(allerror.ErrorBadRequestParam, fmt.Sprintf("duplicate eval suite: %s", v))
+		}
+		names[v] = true
+	}
+
+	return nil
+}
+
+func jobEvalSuites(job *batchv1.Job) []string {
+	if v := job.Annotations[annotationEvals]; v != "" {
+		return strings.Split(v, ",")
+	}
+
+	return nil
+}
+
+func jobEvalResults(job *batchv1.Job) map[string]EvalResult {
+	v := job.Annotations[annotationEvalResults]
+	if v == "" {
+		return nil
+	}
+
+	r := map[string]EvalResult{}
+	if err := json.Unmarshal([]byte(v), &r); err != nil {
+		logrus.Errorf("invalid eval results of job %s, err:%s", job.Name, err.Error())
+	}
+
+	return r
+}
+
+func setEvalResults(cl *cluster, jobName string, results map[string]EvalResult) error {
+	v, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{annotationEvalResults: string(v)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = cl.clientset.BatchV1().Jobs(cl.Namespace).Patch(
+		context.TODO(), jobName, types.MergePatchType, patch, metav1.PatchOptions{},
+	)
+
+	return err
+}
+
+func newEvalJob(job *batchv1.Job, suite *EvalSuite) (*batchv1.Job, error) {
+	model, ok := models[job.Labels["model"]]
+	if !ok {
+		return nil, fmt.Errorf("unknown model: %s", job.Labels["model"])
+	}
+
+	modelPath, err := subPath(model.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := suite.Resources
+	name := uuid.New().String()
+	cl, err := clusterOf(job)
+	if err != nil {
+		return nil, err
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: cl.Namespace,
+			Labels: map[string]string{
+				"create_by":    job.Labels["create_by"],
+				labelEvalOf:    job.Name,
+				labelEvalSuite: suite.Name,
+				labelCluster:   cl.Name,
+			},
+			// the evaluation is queued with the priority of job
+			Annotations: map[string]string{
+				annotationQueued:   "true",
+				annotationPriority: strconv.Itoa(jobPriority(job)),
+				annotationOwner:    job.Annotations[annotationOwner],
+			},
+			// the evaluation is deleted with the job
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(job, batchv1.SchemeGroupVersion.WithKind("Job")),
+			},
+		},
+		Spec: batchv1.JobSpec{
+			Suspend: pointer.Bool(true),
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:    name,
+							Image:   cl.image(suite.Image),
+							Command: suite.Command,
+							Args:    suite.Args,
+							Env:     suite.env(model.Name),
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      volumeModel,
+									MountPath: suite.BaseModelDir,
+									SubPath:   modelPath,
+									ReadOnly:  true,
+								},
+								{
+									Name:      volumeOutput,
+									MountPath: suite.OutputDir,
+									SubPath:   job.Annotations[annotationOutput],
+									ReadOnly:  true,
+								},
+							},
+							Resources: corev1.ResourceRequirements{
+								Requests: resources.resourceList(),
+								Limits:   resources.resourceList(),
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						volumeCfg.Model.volume(volumeModel, true),
+						volumeCfg.Output.volume(volumeOutput, true),
+					},
+					NodeSelector: volumeCfg.NodeSelector,
+					Affinity:     volumeCfg.Affinity,
+				},
+			},
+			BackoffLimit: pointer.Int32(1),
+		},
+	}, nil
+}
+
+// createEvalJob creates the evaluation in the cluster of job, it is admitted by the queue as the finetune jobs
+func createEvalJob(job *batchv1.Job, name string) (string, error) {
+	suite := evalCfg.suite(name)
+	if suite == nil {
+		return "", fmt.Errorf("unknown eval suite: %s", name)
+	}
+
+	evalJob, err := newEvalJob(job, suite)
+	if err != nil {
+		return "", err
+	}
+
+	schedulerCfg.setupJob(evalJob)
+
+	cl, err := clusterOf(job)
+	if err != nil {
+		return "", err
+	}
+
+	if evalJob, err = cl.clientset.BatchV1().Jobs(cl.Namespace).Create(context.TODO(), evalJob, metav1.CreateOptions{}); err != nil {
+		return "", err
+	}
+
+	if err := schedulerCfg.afterCreate(cl, evalJob); err != nil {
+		deletePolicy := metav1.DeletePropagationForeground
+		cl.clientset.BatchV1().Jobs(cl.Namespace).Delete(context.TODO(), evalJob.Name, metav1.DeleteOptions{
+			PropagationPolicy: &deletePolicy,
+		})
+
+		return "", fmt.Errorf("create pod group of eval job %s failed, err:%s", evalJob.Name, err.Error())
+	}
+
+	admission.notify()
+
+	return evalJob.Name, nil
+}
+
+// launchEval creates the evaluation unless it was created but not recorded on the job
+func launchEval(job *batchv1.Job, name string) (string, error) {
+	v, err := jobs.listEvalJobs(job.Name, name)
+	if err != nil {
+		return "", err
+	}
+
+	if len(v) > 0 {
+		return v[0].Name, nil
+	}
+
+	return createEvalJob(job, name)
+}
+
+// readScores parses the scores from the logs of the last pod of the evaluation
+func readScores(cl *cluster, jobName string) (map[string]float64, error) {
+	pods, err := jobs.listPods(jobName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pods) == 0 {
+		return nil, errors.New("no pod of evaluation")
+	}
+
+	sorted := sortPods(pods)
+	pod := sorted[len(sorted)-1]
+
+	stream, err := cl.clientset.CoreV1().Pods(cl.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{}).Stream(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	r := map[string]float64{}
+
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, evalCfg.ScorePrefix) {
+			continue
+		}
+
+		var v map[string]float64
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, evalCfg.ScorePrefix)), &v); err != nil {
+			logrus.Errorf("invalid scores of eval job %s, err:%s", jobName, err.Error())
+
+			continue
+		}
+
+		for k, score := range v {
+			r[k] = score
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(r) == 0 {
+		return nil, errors.New("no scores reported")
+	}
+
+	return r, nil
+}
+
+// evaluate launches the evaluations of the succeeded jobs and records the scores of finished ones
+func evaluate(cl *cluster, job *batchv1.Job) (map[string]EvalResult, bool) {
+	results := jobEvalResults(job)
+	if results == nil {
+		results = map[string]EvalResult{}
+	}
+
+	changed := false
+	for _, name := range jobEvalSuites(job) {
+		r, ok := results[name]
+		if ok && isTerminalStatus(r.Status) {
+			continue
+		}
+
+		if !ok {
+			evalName, err := launchEval(job, name)
+			if err != nil {
+				logrus.Errorf("create eval %s of job %s failed, err:%s", name, job.Name, err.Error())
+				r = EvalResult{Status: statusFailed, Error: "create evaluation failed"}
+			} else {
+				r = EvalResult{JobName: evalName, Status: "Pending"}
+			}
+
+			results[name], changed = r, true
+
+			continue
+		}
+
+		evalJob, err := jobs.getJob(r.JobName)
+		if err != nil {
+			if !isNotFound(err) {
+				logrus.Errorf("get eval job %s failed, err:%s", r.JobName, err.Error())
+
+				continue
+			}
+
+			r.Status, r.Error = statusFailed, "evaluation is deleted"
+		} else if status := jobStatus(evalJob); status == r.Status {
+			continue
+		} else {
+			r.Status = status
+		}
+
+		if r.Status == statusComplete {
+			if r.Scores, err = readScores(cl, r.JobName); err != nil {
+				logrus.Errorf("read scores of eval job %s failed, err:%s", r.JobName, err.Error())
+				r.Status, r.Error = statusFailed, err.Error()
+			}
+		}
+
+		results[name], changed = r, true
+	}
+
+	return results, changed
+}
+
+// runEvaluations checks the evaluations of jobs in background until the server stops
+func runEvaluations() {
+	interval := time.Duration(evalCfg.Interval) * time.Second
+
+	for {
+		jobList, err := jobs.listJobs()
+		if err != nil {
+			logrus.Errorf("list jobs for evaluating failed, err:%s", err.Error())
+		}
+
+		for _, job := range jobList {
+			if len(jobEvalSuites(job)) == 0 || jobStatus(job) != statusComplete {
+				continue
+			}
+
+			cl, err := clusterOf(job)
+			if err != nil {
+				logrus.Errorf("evaluate job %s failed, err:%s", job.Name, err.Error())
+
+				continue
+			}
+
+			results, changed := evaluate(cl, job)
+			if !changed {
+				continue
+			}
+
+			if err := setEvalResults(cl, job.Name, results); err != nil {
+				logrus.Errorf("save eval results of job %s failed, err:%s", job.Name, err.Error())
+			}
+		}
+
+		jobs.waitChange(interval)
+	}
+}
+
+// JobScores is the scores of every suite of a job
+type JobScores struct {
+	JobName   string                        `json:"jobName"`
+	Model     string                        `json:"model"`
+	Dataset   string                        `json:"dataset"`
+	Template  string                        `json:"template"`
+	Parameter map[string]string             `json:"parameter"`
+	Scores    map[string]map[string]float64 `json:"scores"`
+}
+
+// EvalComparison lists the scores of jobs side by side
+type EvalComparison struct {
+	// Suites are the names of scores reported by every suite
+	Suites map[string][]string `json:"suites"`
+	Jobs   []JobScores         `json:"jobs"`
+}
+
+func compareEvals(jobNames []string) (EvalComparison, error) {
+	names := map[string]map[string]bool{}
+	r := EvalComparison{Jobs: make([]JobScores, 0, len(jobNames))}
+
+	for _, jobName := range jobNames {
+		job, err := getJob(jobName)
+		if err != nil {
+			if isNotFound(err) {
+				return r, allerror.NewNotFound(fmt.Sprintf("job %s not found", jobName))
+			}
+
+			return r, err
+		}
+
+		info, err := toJobInfo(job)
+		if err != nil {
+			return r, err
+		}
+
+		item := JobScores{
+			JobName:   job.Name,
+			Model:     info.Model,
+			Dataset:   info.Dataset,
+			Template:  info.Template,
+			Parameter: info.Parameter,
+			Scores:    map[string]map[string]float64{},
+		}
+
+		for suite, v := range info.EvalResults {
+			if v.Status != statusComplete {
+				continue
+			}
+
+			item.Scores[suite] = v.Scores
+
+			if names[suite] == nil {
+				names[suite] = map[string]bool{}
+			}
+			for k := range v.Scores {
+				names[suite][k] = true
+			}
+		}
+
+		r.Jobs = append(r.Jobs, item)
+	}
+
+	r.Suites = make(map[string][]string, len(names))
+	for suite, v := range names {
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		r.Suites[suite] = keys
+	}
+
+	return r, nil
+}
+
+// @Summary		Compare
+// @Description	compare the evaluation scores of finetunes
+// @Tags			Finetune
+// @Param			jobs	query	string	true	"finetune ids separated by comma"
+// @Success		200	{object}		EvalComparison
+// @Failure		500	system_error	system	error
+// @Router			/v1/finetune/evals/compare [get]
+func compareJobEvals(c *gin.Context) {
+	var jobNames []string
+	for _, v := range strings.Split(c.Query("jobs"), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			jobNames = append(jobNames, v)
+		}
+	}
+
+	if len(jobNames) == 0 || len(jobNames) > maxCompareJobs {
+		err := fmt.Errorf("the number of jobs should be in [1, %d]", maxCompareJobs)
+		commonctl.SendBadRequestParam(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	r, err := compareEvals(jobNames)
+	if err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, r)
+}
@@ -0,0 +1,268 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opensourceways/foundation-model-server/allerror"
+	commonctl "github.com/opensourceways/foundation-model-server/common/controller"
+	"github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	labelJobName = "job-name"
+
+	// the events which are not recorded by kubernetes but derived from the status of pod
+	reasonOOMKilled = "OOMKilled"
+	reasonEvicted   = "Evicted"
+)
+
+// JobEvent is a kubernetes event of the job or its pods
+type JobEvent struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Reason    string `json:"reason"`
+	Message   string `json:"message"`
+	Count     int32  `json:"count"`
+	FirstSeen string `json:"first_seen,omitempty"`
+	LastSeen  string `json:"last_seen,omitempty"`
+
+	lastSeen time.Time
+}
+
+func eventTime(t metav1.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+func toJobEvent(e *corev1.Event) JobEvent {
+	last := e.LastTimestamp
+	if last.IsZero() {
+		last = metav1.NewTime(e.EventTime.Time)
+	}
+
+	first := e.FirstTimestamp
+	if first.IsZero() {
+		first = last
+	}
+
+	count := e.Count
+	if count == 0 {
+		count = 1
+	}
+
+	return JobEvent{
+		Kind:      e.InvolvedObject.Kind,
+		Name:      e.InvolvedObject.Name,
+		Type:      e.Type,
+		Reason:    e.Reason,
+		Message:   e.Message,
+		Count:     count,
+		FirstSeen: eventTime(first),
+		LastSeen:  eventTime(last),
+		lastSeen:  last.Time,
+	}
+}
+
+// podStatusEvents derives the events from the status of pod, such as OOMKilled
+// which is only recorded in the container status.
+func podStatusEvents(pod *corev1.Pod) []JobEvent {
+	var r []JobEvent
+
+	newEvent := func(reason, message string, t metav1.Time) JobEvent {
+		return JobEvent{
+			Kind:      "Pod",
+			Name:      pod.Name,
+			Type:      corev1.EventTypeWarning,
+			Reason:    reason,
+			Message:   message,
+			Count:     1,
+			FirstSeen: eventTime(t),
+			LastSeen:  eventTime(t),
+			lastSeen:  t.Time,
+		}
+	}
+
+	if pod.Status.Reason == reasonEvicted {
+		r = append(r, newEvent(reasonEvicted, pod.Status.Message, pod.CreationTimestamp))
+	}
+
+	for i := range pod.Status.ContainerStatuses {
+		status := &pod.Status.ContainerStatuses[i]
+
+		for _, state := range []corev1.ContainerState{status.State, status.LastTerminationState} {
+			if t := state.Terminated; t != nil && t.Reason == reasonOOMKilled {
+				msg := fmt.Sprintf("container %s is killed for out of memory", status.Name)
+				r = append(r, newEvent(reasonOOMKilled, msg, t.FinishedAt))
+			}
+		}
+	}
+
+	return r
+}
+
+func listEvents(cl *cluster, kind, name string) ([]corev1.Event, error) {
+	v, err := cl.clientset.CoreV1().Events(cl.Namespace).List(context.TODO(), metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("involvedObject.kind=%s,involvedObject.name=%s", kind, name),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.Items, nil
+}
+
+// jobEvents aggregates the events of the job and its pods in the cluster from the oldest to the newest
+func jobEvents(cl *cluster, jobName string) ([]JobEvent, error) {
+	items, err := listEvents(cl, "Job", jobName)
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := jobs.listPods(jobName)
+	if err != nil {
+		return nil, err
+	}
+
+	r := make([]JobEvent, 0, len(items))
+
+	for _, pod := range pods {
+		v, err := listEvents(cl, "Pod", pod.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, v...)
+		r = append(r, podStatusEvents(pod)...)
+	}
+
+	for i := range items {
+		r = append(r, toJobEvent(&items[i]))
+	}
+
+	sort.SliceStable(r, func(i, j int) bool {
+		return r[i].lastSeen.Before(r[j].lastSeen)
+	})
+
+	return r, nil
+}
+
+// jobReason summarizes why the job is not running or why it failed
+func jobReason(job *batchv1.Job, pods []*corev1.Pod) string {
+	if isQueued(job) {
+		if reason := admission.reason(job.Name); reason != "" || !waitingForKueue(job) {
+			return reason
+		}
+
+		return "waiting for the admission of kueue"
+	}
+
+	for i := len(job.Status.Conditions) - 1; i >= 0; i-- {
+		cond := &job.Status.Conditions[i]
+		if cond.Type == batchv1.JobFailed && cond.Status == corev1.ConditionTrue {
+			if reason := podsReason(pods); reason != "" {
+				return fmt.Sprintf("%s: %s", cond.Reason, reason)
+			}
+
+			return fmt.Sprintf("%s: %s", cond.Reason, cond.Message)
+		}
+	}
+
+	if status := jobStatus(job); status == statusComplete || status == statusCancelled {
+		return ""
+	}
+
+	return podsReason(pods)
+}
+
+// podsReason returns the reason of the newest pod which has a problem
+func podsReason(pods []*corev1.Pod) string {
+	items := sortPods(pods)
+	for i := len(items) - 1; i >= 0; i-- {
+		if reason := podReason(items[i]); reason != "" {
+			return reason
+		}
+	}
+
+	return ""
+}
+
+func podReason(pod *corev1.Pod) string {
+	if pod.Status.Reason == reasonEvicted {
+		return fmt.Sprintf("%s: %s", reasonEvicted, pod.Status.Message)
+	}
+
+	for i := range pod.Status.Conditions {
+		cond := &pod.Status.Conditions[i]
+		if cond.Type == corev1.PodScheduled && cond.Status == corev1.ConditionFalse {
+			return fmt.Sprintf("%s: %s", cond.Reason, cond.Message)
+		}
+	}
+
+	for i := range pod.Status.ContainerStatuses {
+		status := &pod.Status.ContainerStatuses[i]
+
+		if w := status.State.Waiting; w != nil && w.Reason != "" && w.Reason != "ContainerCreating" {
+			if w.Message == "" {
+				return w.Reason
+			}
+
+			return fmt.Sprintf("%s: %s", w.Reason, w.Message)
+		}
+
+		if t := status.State.Terminated; t != nil && t.ExitCode != 0 {
+			return fmt.Sprintf("%s: container %s exited with code %d", t.Reason, status.Name, t.ExitCode)
+		}
+	}
+
+	return ""
+}
+
+// @Summary		Events
+// @Description	list the kubernetes events of a finetune job and its pods
+// @Tags			Finetune
+// @Param			jobname	path	string	true	"finetune id"
+// @Success		200	{object}		[]JobEvent
+// @Failure		500	system_error	system	error
+// @Router			/v1/job/{jobname}/events [get]
+func getJobEvents(c *gin.Context) {
+	jobName := c.Param("jobname")
+
+	job, err := getJob(jobName)
+	if err != nil {
+		if isNotFound(err) {
+			err = allerror.NewNotFound(fmt.Sprintf("job %s not found", jobName))
+		}
+
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	cl, err := clusterOf(job)
+	if err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	v, err := jobEvents(cl, jobName)
+	if err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, v)
+}
@@ -6,12 +6,12 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/gorilla/websocket" // swagger embed files
 	"github.com/opensourceways/foundation-model-server/allerror"
 	commonctl "github.com/opensourceways/foundation-model-server/common/controller"
 	"github.com/opensourceways/foundation-model-server/common/controller/middleware"
@@ -21,29 +21,42 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/utils/pointer"
 )
 
-const headerSecret = "FINETUNE-SECRET"
+const (
+	headerSecret     = "FINETUNE-SECRET"
+	annotationOutput = "finetune/output"
 
-var (
-	kubeconfig string
-	namespace  string
-	tokens     []string
-	image      string
-	clientset  *kubernetes.Clientset
+	deleteJobTimeout = 5 * time.Minute
 )
 
+var tokens []string
+
 type JobInfo struct {
-	JobName   string            `json:"jobName,omitempty"`
-	Username  string            `json:"username" required:"true"`
-	Dataset   string            `json:"dataset" required:"true"`
-	Model     string            `json:"model" required:"true"`
-	CreatedAt string            `json:"created_at,omitempty"`
-	Status    string            `json:"status,omitempty"`
-	Parameter map[string]string `json:"parameter" required:"true"`
+	JobName       string                `json:"jobName,omitempty"`
+	Username      string                `json:"username" required:"true"`
+	Dataset       string                `json:"dataset" required:"true"`
+	Model         string                `json:"model" required:"true"`
+	Template      string                `json:"template,omitempty"`
+	Output        string                `json:"output,omitempty"`
+	ServedModel   string                `json:"served_model,omitempty"`
+	CreatedAt     string                `json:"created_at,omitempty"`
+	Status        string                `json:"status,omitempty"`
+	Reason        string                `json:"reason,omitempty"`
+	RetryOf       string                `json:"retry_of,omitempty"`
+	Attempt       int                   `json:"attempt,omitempty"`
+	ResumeFrom    string                `json:"resume_from,omitempty"`
+	Priority      int                   `json:"priority,omitempty"`
+	Cluster       string                `json:"cluster,omitempty"`
+	Nodes         int                   `json:"nodes,omitempty"`
+	QueuePosition int                   `json:"queue_position,omitempty"`
+	Sweep         string                `json:"sweep,omitempty"`
+	Evals         []string              `json:"evals,omitempty"`
+	EvalResults   map[string]EvalResult `json:"eval_results,omitempty"`
+	RetentionDays int                   `json:"retention_days,omitempty"`
+	Credentials   map[string]string     `json:"credentials,omitempty"`
+	Parameter     map[string]string     `json:"parameter" required:"true"`
 }
 
 func readLinesFromFile(filename string) ([]string, error) {
@@ -67,27 +80,92 @@ func readLinesFromFile(filename string) ([]string, error) {
 	return lines, nil
 }
 
-func Init(n, k, i, t string) error {
-	kubeconfig = k
-	namespace = n
-	image = i
+func Init(cfg *Config) error {
+	initTemplates(cfg)
+	initModels(cfg)
+	volumeCfg = cfg.Volumes
+	artifactCfg = cfg.Artifact
+	workerCfg = cfg.Worker
+	cancelCfg = cfg.Cancel
+	distributedCfg = cfg.Distributed
+
+	schedulerCfg = cfg.Scheduler
+	placementCfg = cfg.Placement
+
+	// 创建各个集群的 Kubernetes 客户端
+	err := initClusters(cfg.Clusters)
+	if err != nil {
+		return err
+	}
+
+	datasetCfg = cfg.Dataset
+	if datasets, err = newLocalDatasetStore(datasetCfg.Dir); err != nil {
+		return err
+	}
+
+	if metricParse, err = newMetricParser(&cfg.Metrics); err != nil {
+		return err
+	}
+
+	if metrics, err = newLocalMetricStore(cfg.Metrics.Dir); err != nil {
+		return err
+	}
+
+	logsCfg = cfg.Logs
+	if logs, err = newLocalLogStore(&cfg.Logs); err != nil {
+		return err
+	}
+
+	if jobs, err = newJobCache(clusters); err != nil {
+		return err
+	}
 
-	// 创建 Kubernetes 客户端
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	usages, err := newLocalUsageStore(cfg.Queue.Dir)
 	if err != nil {
 		return err
 	}
-	defer os.Remove(kubeconfig)
 
-	clientset, err = kubernetes.NewForConfig(config)
+	if admission, err = newAdmissionQueue(cfg, usages); err != nil {
+		return err
+	}
+	go admission.run()
+
+	go collectors.resync()
+
+	evalCfg = cfg.Eval
+	go runEvaluations()
+
+	sweepCfg = cfg.Sweep
+	store, err := newLocalSweepStore(sweepCfg.Dir)
 	if err != nil {
 		return err
 	}
 
-	if tokens, err = readLinesFromFile(t); err != nil {
+	sweeps = newSweepRunner(store)
+	go sweeps.run()
+
+	webhookCfg = cfg.Webhook
+	hooks, err := newLocalWebhookStore(webhookCfg.Dir)
+	if err != nil {
 		return err
 	}
-	defer os.Remove(t)
+
+	notifier = newWebhookNotifier(hooks)
+	go notifier.run()
+
+	retentionCfg = cfg.Retention
+	archive, err := newLocalArchiveStore(retentionCfg.Dir)
+	if err != nil {
+		return err
+	}
+
+	reaper = newJobReaper(archive)
+	go reaper.run()
+
+	if tokens, err = readLinesFromFile(cfg.Tokens); err != nil {
+		return err
+	}
+	defer os.Remove(cfg.Tokens)
 
 	return nil
 }
@@ -99,59 +177,109 @@ func RegisterRoutes(router *gin.RouterGroup) {
 	router.POST("/v1/job", m, createJob)
 	// 删除作业
 	router.DELETE("/v1/job/:jobname", m, deleteJob)
+	// 取消作业
+	router.POST("/v1/job/:jobname/cancel", m, cancelJob)
+	// 重试作业
+	router.POST("/v1/job/:jobname/retry", m, retryJob)
+	// 作业的保留天数
+	router.POST("/v1/job/:jobname/retention", m, setJobRetention)
+	// 作业及其 Pod 的事件
+	router.GET("/v1/job/:jobname/events", m, getJobEvents)
 
 	router.GET("/v1/log/:jobname", m, getJobLogs)
+	router.GET("/v1/job/:jobname/logs", m, getArchivedJobLogs)
+	// 作业产物
+	router.GET("/v1/job/:jobname/artifacts", m, getJobArtifacts)
+	router.GET("/v1/job/:jobname/artifacts/download", m, downloadJobArtifacts)
+	// 部署微调后的模型
+	router.POST("/v1/job/:jobname/deploy", m, deployJob)
+	router.DELETE("/v1/job/:jobname/deploy", m, undeployJob)
+	// 训练指标
+	router.GET("/v1/job/:jobname/metrics", m, getJobMetrics)
+	router.GET("/v1/job/:jobname/metrics/watch", m, watchJobMetrics)
 	// 获取所有作业
 	router.GET("/v1/job", m, listJobs)
+	// 获取模板的参数定义
+	router.GET("/v1/finetune/templates/:name/schema", m, getTemplateSchema)
+	// 数据集
+	router.POST("/v1/finetune/datasets", m, uploadDataset)
+	router.GET("/v1/finetune/datasets", m, listDatasets)
+	router.GET("/v1/finetune/datasets/:id", m, getDataset)
+	router.DELETE("/v1/finetune/datasets/:id", m, deleteDataset)
+	// 超参数搜索
+	router.POST("/v1/finetune/sweeps", m, createSweep)
+	router.GET("/v1/finetune/sweeps", m, listSweeps)
+	router.GET("/v1/finetune/sweeps/:id", m, getSweep)
+	router.POST("/v1/finetune/sweeps/:id/cancel", m, cancelSweep)
+	// 比较作业的评测分数
+	router.GET("/v1/finetune/evals/compare", m, compareJobEvals)
+	// 已清理作业的归档
+	router.GET("/v1/finetune/archived-jobs", m, listArchivedJobs)
+	router.GET("/v1/finetune/archived-jobs/:jobname", m, getArchivedJob)
+	// 作业状态变化的通知
+	router.POST("/v1/finetune/webhooks", m, createWebhook)
+	router.GET("/v1/finetune/webhooks", m, listWebhooks)
+	router.DELETE("/v1/finetune/webhooks/:id", m, deleteWebhook)
+	router.GET("/v1/finetune/webhooks/:id/deliveries", m, listWebhookDeliveries)
+	// 可微调的模型
+	router.GET("/v1/finetune/models", m, listModels)
 }
 
 // @Title			List
-// @Description	list jobs
+// @Description	list jobs, the token of next page is returned in the header of X-Continue
 // @Tags			Finetune
+// @Param			username		query	string	false	"creator of job"
+// @Param			model			query	string	false	"base model"
+// @Param			dataset			query	string	false	"dataset id"
+// @Param			status			query	string	false	"job status"
+// @Param			created_after	query	string	false	"RFC3339 time"
+// @Param			created_before	query	string	false	"RFC3339 time"
+// @Param			order			query	string	false	"asc or desc by creation time, default asc"
+// @Param			limit			query	int		false	"max jobs of a page"
+// @Param			continue		query	string	false	"token of the page"
 // @Success		200	{object}		[]JobInfo
 // @Failure		500	system_error	system	error
 // @Router			/v1/job [get]
 func listJobs(c *gin.Context) {
-	// 使用 clientset 进行操作
-	jobList, err := clientset.BatchV1().Jobs(namespace).List(context.TODO(), metav1.ListOptions{})
+	opt, err := parseJobListOption(c)
+	if err != nil {
+		commonctl.SendBadRequestParam(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	// 从缓存中读取
+	jobList, err := jobs.listJobs()
 	if err != nil {
 		commonctl.SendFailedResp(c, err)
 		logrus.Error(err.Error())
 		return
 	}
 
-	// 构造作业信息列表
-	jobInfos := make([]JobInfo, 0)
-	for _, job := range jobList.Items {
-		var status string
-		if len(job.Status.Conditions) == 0 && job.Status.Active > 0 {
-			// 当条件列表为空且有活动的副本时，将作业状态设置为"Running"
-			status = "Running"
-		} else if len(job.Status.Conditions) == 0 {
-			// 当条件列表为空且没有活动的副本时，将作业状态设置为"Pending"
-			status = "Pending"
-		} else {
-			// 查找具有最新时间戳的条件
-			latestCondition := job.Status.Conditions[len(job.Status.Conditions)-1]
-			status = string(latestCondition.Type)
-		}
+	pods, err := jobs.listPodsByJob()
+	if err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	page, next := filterJobs(jobList, &opt)
+	if next != nil {
+		c.Header(headerContinue, next.encode())
+	}
 
-		params, err := getEnvs(&job, true)
+	// 构造作业信息列表
+	jobInfos := make([]JobInfo, 0, len(page))
+	for _, job := range page {
+		jobInfo, err := toJobInfo(job)
 		if err != nil {
 			commonctl.SendFailedResp(c, err)
 			logrus.Error(err.Error())
 			return
 		}
+		jobInfo.Reason = jobReason(job, pods[job.Name])
+		jobInfo.QueuePosition = admission.position(job.Name)
 
-		jobInfo := JobInfo{
-			JobName:   job.Name,
-			Username:  job.Labels["create_by"],
-			Dataset:   job.Labels["data"],
-			Model:     job.Labels["model"],
-			CreatedAt: job.CreationTimestamp.Format(time.RFC3339),
-			Status:    status,
-			Parameter: params,
-		}
 		jobInfos = append(jobInfos, jobInfo)
 	}
 
@@ -159,13 +287,72 @@ func listJobs(c *gin.Context) {
 	c.JSON(http.StatusOK, jobInfos)
 }
 
+func jobStatus(job *batchv1.Job) string {
+	if isCancelled(job) {
+		return statusCancelled
+	}
+
+	if isQueued(job) {
+		return statusQueued
+	}
+
+	if len(job.Status.Conditions) == 0 && job.Status.Active > 0 {
+		// 当条件列表为空且有活动的副本时，将作业状态设置为"Running"
+		return "Running"
+	}
+
+	if len(job.Status.Conditions) == 0 {
+		// 当条件列表为空且没有活动的副本时，将作业状态设置为"Pending"
+		return "Pending"
+	}
+
+	// 查找具有最新时间戳的条件
+	latestCondition := job.Status.Conditions[len(job.Status.Conditions)-1]
+
+	return string(latestCondition.Type)
+}
+
+func toJobInfo(job *batchv1.Job) (JobInfo, error) {
+	params, err := getEnvs(job, true)
+	if err != nil {
+		return JobInfo{}, err
+	}
+
+	cl, err := clusterOf(job)
+	if err != nil {
+		return JobInfo{}, err
+	}
+
+	return JobInfo{
+		JobName:       job.Name,
+		Username:      job.Labels["create_by"],
+		Dataset:       job.Labels["data"],
+		Model:         job.Labels["model"],
+		Template:      job.Labels["template"],
+		Output:        job.Annotations[annotationOutput],
+		ServedModel:   job.Annotations[annotationServedModel],
+		CreatedAt:     job.CreationTimestamp.Format(time.RFC3339),
+		Status:        jobStatus(job),
+		RetryOf:       job.Annotations[annotationRetryOf],
+		Attempt:       jobAttempt(job),
+		ResumeFrom:    job.Annotations[annotationResumeFrom],
+		Priority:      jobPriority(job),
+		Cluster:       cl.Name,
+		Nodes:         jobNodes(job),
+		Sweep:         job.Annotations[annotationSweep],
+		Evals:         jobEvalSuites(job),
+		EvalResults:   jobEvalResults(job),
+		RetentionDays: jobRetentionDays(job),
+		Parameter:     params,
+	}, nil
+}
+
 // 查询作业状态
 func getJobStatus(c *gin.Context) {
 	// 从路径参数中获取作业名称和命名空间
 	jobName := c.Param("jobname")
 
-	// 使用 clientset 进行操作
-	job, err := clientset.BatchV1().Jobs(namespace).Get(context.TODO(), jobName, metav1.GetOptions{})
+	job, err := getJob(jobName)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"msg": err.Error()})
 		logrus.Error(err.Error())
@@ -189,8 +376,8 @@ func getEnvs(job *batchv1.Job, skipSecret bool) (envs map[string]string, err err
 	// 提取 Pod 的环境变量
 	for _, container := range job.Spec.Template.Spec.Containers {
 		for _, envVar := range container.Env {
-			// 不返回secret
-			if envVar.Name == "SECRET" && skipSecret {
+			// 不返回secret, 从secret读取的环境变量不是参数
+			if (envVar.Name == envSecret && skipSecret) || envVar.ValueFrom != nil {
 				continue
 			}
 			envs[strings.ToLower(envVar.Name)] = envVar.Value
@@ -209,6 +396,64 @@ func validFinetuneToken(secret string) bool {
 	return false
 }
 
+// submitJob checks the job and creates it in the queue of admission
+func submitJob(jobInfo *JobInfo, secret string) (*batchv1.Job, error) {
+	tpl, err := getTemplate(jobInfo.Template)
+	if err != nil {
+		return nil, err
+	}
+	jobInfo.Template = tpl.Name
+
+	if err := tpl.checkParameters(jobInfo.Parameter); err != nil {
+		return nil, err
+	}
+
+	model, err := getModel(jobInfo.Model, tpl)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkDatasetExists(jobInfo.Dataset); err != nil {
+		return nil, err
+	}
+
+	if err := checkEvalSuites(jobInfo.Evals); err != nil {
+		return nil, err
+	}
+
+	if err := checkRetentionDays(jobInfo.RetentionDays); err != nil {
+		return nil, err
+	}
+
+	if err := checkCredentials(tpl, jobInfo.Parameter, jobInfo.Credentials); err != nil {
+		return nil, err
+	}
+
+	logrus.Infof("username: %s dataset: %s model: %s template: %s parameter: %v", jobInfo.Username, jobInfo.Dataset, jobInfo.Model, jobInfo.Template, jobInfo.Parameter)
+
+	jobInfo.Parameter = tpl.mergeParameters(jobInfo.Parameter)
+	jobInfo.Parameter["model_name"] = jobInfo.Model
+	jobInfo.Parameter["dataset"] = jobInfo.Dataset
+	resources := model.resources(tpl)
+	jobInfo.Parameter["npu_number"] = resources.npuNumber()
+
+	cl, err := placeJob(jobInfo.Cluster, resources.npus())
+	if err != nil {
+		return nil, err
+	}
+
+	// 创建作业对象
+	job, err := doCreateJob(cl, tpl, model, jobInfo, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	admission.notify()
+	collectors.start(job.Name)
+
+	return job, nil
+}
+
 // @Summary		Create
 // @Description	create finetune
 // @Tags			Finetune
@@ -235,6 +480,17 @@ func createJob(c *gin.Context) {
 		return
 	}
 
+	// the lineage of attempts is only set by retrying and the sweep by the sweep runner
+	jobInfo.RetryOf, jobInfo.Attempt, jobInfo.ResumeFrom, jobInfo.Sweep = "", 0, "", ""
+	jobInfo.EvalResults = nil
+
+	if jobInfo.Priority < 0 || jobInfo.Priority > admission.cfg.MaxPriority {
+		err := fmt.Errorf("invalid priority, it should be in [0, %d]", admission.cfg.MaxPriority)
+		logrus.Error(err)
+		commonctl.SendBadRequestBody(c, err)
+		return
+	}
+
 	if secret == "" {
 		err := allerror.New(allerror.ErrorPermissionDeny, "Permission denied, empty finetune token")
 		logrus.Error(err)
@@ -249,44 +505,34 @@ func createJob(c *gin.Context) {
 		return
 	}
 
-	logrus.Infof("username: %s dataset: %s model: %s parameter: %v", jobInfo.Username, jobInfo.Dataset, jobInfo.Model, jobInfo.Parameter)
-
-	jobInfo.Parameter["secret"] = c.GetHeader(headerSecret)
-	jobInfo.Parameter["model_name"] = jobInfo.Model
-	jobInfo.Parameter["dataset"] = jobInfo.Dataset
-	jobInfo.Parameter["npu_number"] = "4"
-
-	// 创建作业对象
-	job, err := doCreateJob(clientset, jobInfo.Username, jobInfo.Dataset, jobInfo.Model, &jobInfo.Parameter, 120)
+	job, err := submitJob(&jobInfo, secret)
 	if err != nil {
 		commonctl.SendFailedResp(c, err)
 		logrus.Error(err.Error())
 		return
 	}
 
-	params, err := getEnvs(job, true)
+	info, err := toJobInfo(job)
 	if err != nil {
 		commonctl.SendFailedResp(c, err)
 		logrus.Error(err.Error())
 		return
 	}
+	info.Status = statusQueued
 
 	// 返回创建成功的响应
-	c.JSON(http.StatusOK, JobInfo{
-		JobName:   job.Name,
-		Username:  job.GetObjectMeta().GetLabels()["create_by"],
-		Dataset:   job.GetObjectMeta().GetLabels()["data"],
-		Model:     job.GetObjectMeta().GetLabels()["model"],
-		Parameter: params,
-		CreatedAt: job.CreationTimestamp.Format(time.RFC3339),
-		Status:    "Running",
-	})
+	c.JSON(http.StatusOK, info)
 }
 
-// @Summary		get a websocket to watch a finetune log
+// @Summary		get a websocket or a server-sent events stream to watch a finetune log
 // @Description	watch single finetune
 // @Tags			Finetune
-// @Param			jobname	path	string	true	"finetune id"
+// @Param			jobname			path	string	true	"finetune id"
+// @Param			tailLines		query	int		false	"number of lines from the end"
+// @Param			sinceSeconds	query	int		false	"only the logs newer than it"
+// @Param			timestamps		query	bool	false	"add timestamp to every line"
+// @Param			follow			query	bool	false	"follow the logs, default true"
+// @Param			transport		query	string	false	"sse or websocket, default websocket"
 // @Accept			json
 // @Success		200	{object}		string
 // @Failure		500	system_error	system	error
@@ -294,92 +540,47 @@ func createJob(c *gin.Context) {
 func getJobLogs(c *gin.Context) {
 	// 从路径参数中获取作业名称和命名空间
 	jobName := c.Param("jobname")
-	var upgrader = websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool {
-			return true // 允许跨域访问
-		},
-	}
 
-	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	opt, err := parseLogStreamOption(c)
 	if err != nil {
-		commonctl.SendFailedResp(c, err)
+		commonctl.SendBadRequestParam(c, err)
 		logrus.Error(err.Error())
 		return
 	}
 
-	defer ws.Close()
-	if err := doWatchJob(ws, clientset, namespace, jobName); err != nil {
+	archived, err := archivedLogs(jobName)
+	if err != nil {
 		commonctl.SendFailedResp(c, err)
 		logrus.Error(err.Error())
+		return
 	}
-}
-
-func startPingTimer(conn *websocket.Conn) *time.Timer {
-	timer := time.NewTimer(60 * time.Second)
 
-	go func() {
-		for range timer.C {
-			err := conn.WriteMessage(websocket.PingMessage, nil)
-			if err != nil {
-				logrus.Infoln("Write ping error:", err)
-			} else {
-				logrus.Infoln("Ping sent to client")
-			}
-			// 重置定时器
-			timer.Reset(60 * time.Second)
+	var sender logSender
+	if wantSSE(c) {
+		sender = newSSELogSender(c)
+	} else {
+		ws, err := newUpgrader().Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			// the upgrader has replied the error
+			logrus.Error(err.Error())
+			return
 		}
-	}()
+		defer ws.Close()
 
-	return timer
-}
+		sender = newWSLogSender(ws)
+	}
 
-func doWatchJob(ws *websocket.Conn, clientset *kubernetes.Clientset, namespacm, jobName string) error {
+	if archived {
+		err = sendArchivedLogs(sender, jobName, &opt)
+	} else {
+		err = doWatchJob(sender, jobName, &opt)
+	}
 
-	ctx := context.TODO()
-	// 获取pod以便获取日志
-	podList, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
-		LabelSelector: "job-name=" + jobName,
-	})
 	if err != nil {
 		logrus.Error(err.Error())
-		err = fmt.Errorf("get job failed")
-		return err
 	}
 
-	// 启动goroutine发送ping消息
-	timer := startPingTimer(ws)
-	defer timer.Stop()
-
-	for _, pod := range podList.Items {
-		req := clientset.CoreV1().Pods(namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
-			Follow: true, // 实时跟踪日志
-		})
-		podLogs, err := req.Stream(ctx)
-		if err != nil {
-			logrus.Error(err.Error())
-			err = fmt.Errorf("get job logs failed")
-			return err
-		}
-		defer podLogs.Close()
-
-		// 读取日志内容
-		buf := make([]byte, 4096)
-		for {
-			n, err := podLogs.Read(buf)
-			if err != nil {
-				logrus.Warningf("read pod logs end: %s", err.Error())
-				break
-			}
-			if n > 0 {
-				if err := ws.WriteMessage(websocket.BinaryMessage, buf[:n]); err != nil {
-					logrus.Warningf("write socket end: %s", err.Error())
-					break
-				}
-			}
-		}
-	}
-
-	return nil
+	sender.close(finalJobStatus(jobName), err)
 }
 
 // @Summary		Delete
@@ -395,14 +596,14 @@ func deleteJob(c *gin.Context) {
 	jobname := c.Param("jobname")
 	secret := c.GetHeader(headerSecret)
 
-	err := checkDeletePerm(clientset, jobname, namespace, secret)
+	err := checkJobPerm(jobname, secret, "delete")
 	if err != nil {
 		commonctl.SendFailedResp(c, err)
 		logrus.Error(err.Error())
 		return
 	}
 
-	err = doDeleteJob(clientset, jobname, namespace)
+	err = doDeleteJob(jobname)
 	if err != nil {
 		commonctl.SendFailedResp(c, err)
 		logrus.Error(err.Error())
@@ -427,222 +628,264 @@ func createEnvVars(envVars *map[string]string) []corev1.EnvVar {
 	return env
 }
 
-func doCreateJob(clientset *kubernetes.Clientset, username, dataset, model string, parameter *map[string]string, timeout int) (jobObj *batchv1.Job, err error) {
+// doCreateJob creates the job suspended in the queue of the cluster, it is resumed when admitted.
+// The token of job is passed by the secret of job and only its hash is recorded.
+func doCreateJob(cl *cluster, tpl *JobTemplate, baseModel *BaseModel, jobInfo *JobInfo, secret string) (jobObj *batchv1.Job, err error) {
 	jobName := uuid.New().String()
+	username, dataset, model := jobInfo.Username, jobInfo.Dataset, jobInfo.Model
+	resources := baseModel.resources(tpl)
+
+	volumes, mounts, err := jobVolumes(tpl, baseModel, dataset, jobName, jobInfo.ResumeFrom)
+	if err != nil {
+		logrus.Error(err.Error())
+		err = allerror.New(allerror.ErrorBadRequestParam, "invalid model or dataset")
+		return
+	}
+
+	env := createEnvVars(&jobInfo.Parameter)
+	env = append(env, credentialEnvs(jobName, jobInfo.Credentials)...)
+	if hasOutputVolume() {
+		env = append(env, corev1.EnvVar{
+			Name:  envOutputDir,
+			Value: tpl.Mounts.OutputDir,
+		})
+	}
+
+	if jobInfo.ResumeFrom != "" {
+		env = append(env, corev1.EnvVar{
+			Name:  envResumeFrom,
+			Value: tpl.Mounts.ResumeDir,
+		})
+	}
 
 	job := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      jobName,
-			Namespace: namespace,
+			Namespace: cl.Namespace,
 			Labels: map[string]string{
-				"create_by": username,
-				"model":     model,
-				"data":      dataset,
-				"parameter": "",
+				"create_by":  username,
+				"model":      model,
+				"data":       dataset,
+				"template":   tpl.Name,
+				"parameter":  "",
+				labelCluster: cl.Name,
+			},
+			Annotations: map[string]string{
+				annotationQueued:   "true",
+				annotationPriority: strconv.Itoa(jobInfo.Priority),
+				annotationOwner:    ownerHash(secret),
 			},
 		},
 		Spec: batchv1.JobSpec{
+			Suspend: pointer.Bool(true),
 			Template: corev1.PodTemplateSpec{
 				Spec: corev1.PodSpec{
-					RestartPolicy: corev1.RestartPolicyNever,
+					RestartPolicy:                 corev1.RestartPolicyNever,
+					TerminationGracePeriodSeconds: pointer.Int64(cancelCfg.GracePeriod),
 					Containers: []corev1.Container{
 						{
-							Name:    jobName,
-							Image:   image,
-							Command: []string{"/bin/bash", "-i", "/root/run_finetune.sh"},
-							VolumeMounts: []corev1.VolumeMount{
-								corev1.VolumeMount{
-									Name:      "model",
-									MountPath: "/opt/" + model,
-								},
-								corev1.VolumeMount{
-									Name:      "dataset",
-									MountPath: "/opt/" + dataset + ".json",
-								},
-							},
+							Name:         jobName,
+							Image:        cl.image(tpl.Image),
+							Command:      tpl.Command,
+							VolumeMounts: mounts,
 							Resources: corev1.ResourceRequirements{
-								Requests: corev1.ResourceList{
-									"huawei.com/Ascend910": resourceQuantity("4"),
-								},
-								Limits: corev1.ResourceList{
-									"huawei.com/Ascend910": resourceQuantity("4"),
-								},
-							},
-							Env: createEnvVars(parameter),
-						},
-					},
-					Volumes: []corev1.Volume{
-						{
-							Name: "model",
-							VolumeSource: corev1.VolumeSource{
-								HostPath: &corev1.HostPathVolumeSource{
-									Path: "/data/disk1/model/" + model,
-									Type: (*corev1.HostPathType)(pointer.String(string(corev1.HostPathDirectory))),
-								},
-							},
-						},
-						{
-							Name: "dataset",
-							VolumeSource: corev1.VolumeSource{
-								HostPath: &corev1.HostPathVolumeSource{
-									Path: "/data/disk1/dataset/" + dataset + ".json",
-									Type: (*corev1.HostPathType)(pointer.String(string(corev1.HostPathFile))),
-								},
+								Requests: resources.resourceList(),
+								Limits:   resources.resourceList(),
 							},
+							Env: env,
 						},
 					},
+					Volumes:      volumes,
+					NodeSelector: volumeCfg.NodeSelector,
+					Affinity:     volumeCfg.Affinity,
 				},
 			},
 			BackoffLimit: pointer.Int32(1),
 		},
 	}
 
-	jobObj, err = clientset.BatchV1().Jobs(namespace).Create(context.TODO(), job, metav1.CreateOptions{})
+	if hasOutputVolume() {
+		job.Annotations[annotationOutput] = jobName
+	}
+
+	if jobInfo.RetryOf != "" {
+		job.Annotations[annotationRetryOf] = jobInfo.RetryOf
+		job.Annotations[annotationAttempt] = strconv.Itoa(jobInfo.Attempt)
+	}
+
+	if jobInfo.ResumeFrom != "" {
+		job.Annotations[annotationResumeFrom] = jobInfo.ResumeFrom
+	}
+
+	if jobInfo.Sweep != "" {
+		job.Annotations[annotationSweep] = jobInfo.Sweep
+	}
+
+	if len(jobInfo.Evals) > 0 {
+		job.Annotations[annotationEvals] = strings.Join(jobInfo.Evals, ",")
+	}
+
+	if jobInfo.RetentionDays != 0 {
+		job.Annotations[annotationRetentionDays] = strconv.Itoa(jobInfo.RetentionDays)
+	}
+
+	setupDistributed(job, &resources)
+	schedulerCfg.setupJob(job)
+
+	jobObj, err = cl.clientset.BatchV1().Jobs(cl.Namespace).Create(context.TODO(), job, metav1.CreateOptions{})
 	if err != nil {
 		logrus.Error(err.Error())
 		err = fmt.Errorf("create job failed")
 		return
 	}
 
-	timeoutTime := time.Now().Add(time.Duration(timeout) * time.Second)
-
-	var pods *corev1.PodList
-	// 等待 Pod 创建成功
-	for {
-		pods, err = clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
-			LabelSelector: fmt.Sprintf("job-name=%s", jobName),
-		})
-		if err != nil {
-			// 等待一段时间后重新检查
-			time.Sleep(5 * time.Second)
-			continue
+	if err = createCredentialsSecret(cl, jobObj, secret, jobInfo.Credentials); err == nil {
+		if err = createRendezvousService(cl, jobObj); err == nil {
+			err = schedulerCfg.afterCreate(cl, jobObj)
 		}
+	}
 
-		if len(pods.Items) > 0 {
-			// 检查所有 Pod 的状态
-			allRunning := true
-			for _, pod := range pods.Items {
-				if pod.Status.Phase != corev1.PodRunning {
-					allRunning = false
-					break
-				}
-			}
-
-			if allRunning {
-				// 所有 Pod 都处于 Running 状态
-				return
-			}
-		}
+	if err != nil {
+		logrus.Error(err.Error())
 
-		if time.Now().After(timeoutTime) {
-			// 删除 Job 和 Pod
-			deletePolicy := metav1.DeletePropagationForeground
-			clientset.BatchV1().Jobs(namespace).Delete(context.TODO(), jobName, metav1.DeleteOptions{
-				PropagationPolicy: &deletePolicy,
-			})
-
-			for _, pod := range pods.Items {
-				clientset.CoreV1().Pods(namespace).Delete(context.TODO(), pod.Name, metav1.DeleteOptions{
-					PropagationPolicy: &deletePolicy,
-				})
-			}
+		deletePolicy := metav1.DeletePropagationForeground
+		cl.clientset.BatchV1().Jobs(cl.Namespace).Delete(context.TODO(), jobName, metav1.DeleteOptions{
+			PropagationPolicy: &deletePolicy,
+		})
 
-			return nil, allerror.New(allerror.ErrorCodeReqTimeout, "timeout waiting for job running")
-		}
-		// 等待一段时间后重新检查
-		time.Sleep(5 * time.Second)
+		return nil, fmt.Errorf("create job failed")
 	}
+
+	return
 }
 
-func checkDeletePerm(clientset *kubernetes.Clientset, jobName, namespace, secret string) error {
+func checkJobPerm(jobName, secret, action string) error {
 	if secret == "" {
 		return allerror.New(allerror.ErrorPermissionDeny, "Permission denied, empty finetune token")
 	}
-	// 删除job
-	job, err := clientset.BatchV1().Jobs(namespace).Get(context.TODO(), jobName, metav1.GetOptions{})
+	job, err := getJob(jobName)
 	if err != nil {
 		logrus.Error(err.Error())
 		err = fmt.Errorf("get job info failed")
 		return err
 	}
 
-	params, err := getEnvs(job, false)
+	owner, err := isOwner(job, secret)
 	if err != nil {
 		logrus.Error(err.Error())
 		err = fmt.Errorf("get job info failed")
 		return err
 	}
 	// check secret
-	if s, ok := params["secret"]; ok && s != secret {
-		return allerror.New(allerror.ErrorPermissionDeny, "Permission denied, you can't delete jobs created by others")
+	if !owner {
+		return allerror.New(allerror.ErrorPermissionDeny, fmt.Sprintf("Permission denied, you can't %s jobs created by others", action))
 	}
 	return nil
 }
 
-func doDeleteJob(clientset *kubernetes.Clientset, jobName, namespace string) error {
-	// 删除job
-	err := clientset.BatchV1().Jobs(namespace).Delete(context.TODO(), jobName, metav1.DeleteOptions{})
+func doDeleteJob(jobName string) error {
+	job, err := getJob(jobName)
+	if err != nil {
+		logrus.Error(err.Error())
+		err = fmt.Errorf("get job info failed")
+		return err
+	}
+
+	cl, err := clusterOf(job)
+	if err != nil {
+		logrus.Error(err.Error())
+		return fmt.Errorf("get job info failed")
+	}
+
+	// 删除job, 其拥有的 secret 等资源由垃圾回收删除
+	deletePolicy := metav1.DeletePropagationBackground
+	err = cl.clientset.BatchV1().Jobs(cl.Namespace).Delete(context.TODO(), jobName, metav1.DeleteOptions{
+		PropagationPolicy: &deletePolicy,
+	})
 	if err != nil {
 		logrus.Error(err.Error())
 		err = fmt.Errorf("delete job failed")
 		return err
 	}
 
+	// the NPUs used by the job are still counted in the quota of user after it is deleted
+	if _, err := admission.recordUsage(job); err != nil {
+		logrus.Errorf("save usage of job %s failed, err:%s", jobName, err.Error())
+	}
+
+	if err := deleteRendezvousService(cl, jobName); err != nil {
+		logrus.Error(err.Error())
+		return fmt.Errorf("delete job failed")
+	}
+
+	if err := deleteCredentialsSecret(cl, jobName); err != nil {
+		logrus.Error(err.Error())
+		return fmt.Errorf("delete job failed")
+	}
+
+	// the workers deployed before they are owned by the job are not deleted with it
+	if err := deleteWorker(cl, jobName); err != nil && !isNotFound(err) {
+		logrus.Error(err.Error())
+		return fmt.Errorf("delete job failed")
+	}
+
 	// 删除相关的 Pod
-	podList, err := clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
-		LabelSelector: "job-name=" + jobName,
-	})
+	pods, err := jobs.listPods(jobName)
 	if err != nil {
 		logrus.Error(err.Error())
 		err = fmt.Errorf("get job info failed")
 		return err
 	}
 
-	var pods []string
-	for _, pod := range podList.Items {
-		err = clientset.CoreV1().Pods(namespace).Delete(context.TODO(), pod.Name, metav1.DeleteOptions{})
-		if err != nil {
+	for _, pod := range pods {
+		err = cl.clientset.CoreV1().Pods(cl.Namespace).Delete(context.TODO(), pod.Name, metav1.DeleteOptions{})
+		if err != nil && !isNotFound(err) {
 			logrus.Error(err.Error())
 			err = fmt.Errorf("delete job failed")
 			return err
 		}
-		pods = append(pods, pod.Name)
 	}
-	// 等待job删除成功
-	for {
-		_, err := clientset.BatchV1().Jobs(namespace).Get(context.TODO(), jobName, metav1.GetOptions{})
-		if err != nil {
-			if isNotFound(err) {
-				break
-			} else {
-				logrus.Error(err.Error())
-				err = fmt.Errorf("create job failed")
-				return err
-			}
-		}
 
-		time.Sleep(1 * time.Second)
-	}
-	// 等待pod删除成功
-	for _, pod := range pods {
-		podDeleted := false
-		for !podDeleted {
-			_, err := clientset.CoreV1().Pods(namespace).Get(context.TODO(), pod, metav1.GetOptions{})
-			if err != nil {
-				if isNotFound(err) {
-					podDeleted = true
-				} else {
-					break
-				}
-			}
+	ctx, cancel := context.WithTimeout(context.Background(), deleteJobTimeout)
+	defer cancel()
 
-			time.Sleep(1 * time.Second)
+	// 等待job和pod删除成功
+	err = jobs.waitFor(ctx, func() (bool, error) {
+		if _, err := jobs.getJob(jobName); !isNotFound(err) {
+			return false, nil
 		}
+
+		pods, err := jobs.listPods(jobName)
+
+		return len(pods) == 0, err
+	})
+	if err != nil {
+		logrus.Error(err.Error())
+		err = fmt.Errorf("delete job failed")
+		return err
 	}
+
 	return nil
 }
 
 // helpers
+// getJob reads the job from the cache, and from the api servers of clusters if it is not
+// in the cache, because the job created just now may not be synced.
+func getJob(jobName string) (job *batchv1.Job, err error) {
+	if job, err = jobs.getJob(jobName); err == nil || !isNotFound(err) {
+		return
+	}
+
+	for _, cl := range clusters {
+		job, err = cl.clientset.BatchV1().Jobs(cl.Namespace).Get(context.TODO(), jobName, metav1.GetOptions{})
+		if err == nil || !isNotFound(err) {
+			return
+		}
+	}
+
+	return
+}
+
 func isNotFound(err error) bool {
 	if statusError, ok := err.(*errors.StatusError); ok {
 		if statusError.ErrStatus.Reason == metav1.StatusReasonNotFound {
@@ -0,0 +1,260 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const cacheSyncTimeout = time.Minute
+
+var jobs *jobCache
+
+// jobCache serves the jobs and pods of the namespaces of all the clusters from the shared
+// informers, and wakes up the waiters when any of them changes. The names of jobs are
+// unique in all the clusters.
+type jobCache struct {
+	listers []clusterListers
+
+	mutex   sync.Mutex
+	changed chan struct{}
+}
+
+// clusterListers lists the jobs and pods in the namespace of a cluster
+type clusterListers struct {
+	cluster   *cluster
+	namespace string
+	jobLister batchlisters.JobLister
+	podLister corelisters.PodLister
+}
+
+func newJobCache(clusters []*cluster) (*jobCache, error) {
+	c := &jobCache{
+		listers: make([]clusterListers, 0, len(clusters)),
+		changed: make(chan struct{}),
+	}
+
+	for _, cl := range clusters {
+		if err := c.addCluster(cl); err != nil {
+			return nil, fmt.Errorf("sync cache of cluster %s failed, err:%s", cl.Name, err.Error())
+		}
+	}
+
+	return c, nil
+}
+
+func (c *jobCache) addCluster(cl *cluster) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(
+		cl.clientset, 0, informers.WithNamespace(cl.Namespace),
+	)
+
+	c.listers = append(c.listers, clusterListers{
+		cluster:   cl,
+		namespace: cl.Namespace,
+		jobLister: factory.Batch().V1().Jobs().Lister(),
+		podLister: factory.Core().V1().Pods().Lister(),
+	})
+
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { c.notify() },
+		UpdateFunc: func(interface{}, interface{}) { c.notify() },
+		DeleteFunc: func(interface{}) { c.notify() },
+	}
+
+	if _, err := factory.Batch().V1().Jobs().Informer().AddEventHandler(handler); err != nil {
+		return err
+	}
+
+	if _, err := factory.Core().V1().Pods().Informer().AddEventHandler(handler); err != nil {
+		return err
+	}
+
+	// the informers run as long as the server
+	factory.Start(make(chan struct{}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), cacheSyncTimeout)
+	defer cancel()
+
+	for t, ok := range factory.WaitForCacheSync(ctx.Done()) {
+		if !ok {
+			return fmt.Errorf("sync cache of %s failed", t.String())
+		}
+	}
+
+	return nil
+}
+
+func (c *jobCache) notify() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *jobCache) changes() <-chan struct{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.changed
+}
+
+// waitFor checks cond every time the jobs or pods change until it is true
+func (c *jobCache) waitFor(ctx context.Context, cond func() (bool, error)) error {
+	for {
+		ch := c.changes()
+
+		if ok, err := cond(); err != nil || ok {
+			return err
+		}
+
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// waitChange waits until the jobs or pods change or the timeout
+func (c *jobCache) waitChange(timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-c.changes():
+	case <-timer.C:
+	}
+}
+
+// getJob returns the job in the cache, the object must not be modified.
+func (c *jobCache) getJob(jobName string) (job *batchv1.Job, err error) {
+	for i := range c.listers {
+		l := &c.listers[i]
+
+		if job, err = l.jobLister.Jobs(l.namespace).Get(jobName); err == nil || !isNotFound(err) {
+			return
+		}
+	}
+
+	return
+}
+
+func (c *jobCache) listJobsBy(selector labels.Selector) ([]*batchv1.Job, error) {
+	var r []*batchv1.Job
+	for i := range c.listers {
+		l := &c.listers[i]
+
+		v, err := l.jobLister.Jobs(l.namespace).List(selector)
+		if err != nil {
+			return nil, err
+		}
+
+		r = append(r, v...)
+	}
+
+	return r, nil
+}
+
+func (c *jobCache) listPodsBy(selector labels.Selector) ([]*corev1.Pod, error) {
+	var r []*corev1.Pod
+	for i := range c.listers {
+		l := &c.listers[i]
+
+		v, err := l.podLister.Pods(l.namespace).List(selector)
+		if err != nil {
+			return nil, err
+		}
+
+		r = append(r, v...)
+	}
+
+	return r, nil
+}
+
+// listClusterPods returns the pods in the namespace of cluster
+func (c *jobCache) listClusterPods(cl *cluster) ([]*corev1.Pod, error) {
+	for i := range c.listers {
+		if l := &c.listers[i]; l.cluster == cl {
+			return l.podLister.Pods(l.namespace).List(labels.Everything())
+		}
+	}
+
+	return nil, fmt.Errorf("unknown cluster: %s", cl.Name)
+}
+
+// listJobs returns the finetune jobs from the oldest to the newest, the evaluations are excluded
+func (c *jobCache) listJobs() ([]*batchv1.Job, error) {
+	selector, err := labels.Parse("!" + labelEvalOf)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.listSortedJobs(selector)
+}
+
+// listQueuedJobs returns the finetune jobs and the evaluations from the oldest to the newest,
+// they are admitted by the same queue.
+func (c *jobCache) listQueuedJobs() ([]*batchv1.Job, error) {
+	return c.listSortedJobs(labels.Everything())
+}
+
+func (c *jobCache) listSortedJobs(selector labels.Selector) ([]*batchv1.Job, error) {
+	v, err := c.listJobsBy(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(v, func(i, j int) bool {
+		if v[i].CreationTimestamp.Equal(&v[j].CreationTimestamp) {
+			return v[i].Name < v[j].Name
+		}
+
+		return v[i].CreationTimestamp.Before(&v[j].CreationTimestamp)
+	})
+
+	return v, nil
+}
+
+// listEvalJobs returns the evaluations of the suite on the output of job
+func (c *jobCache) listEvalJobs(jobName, suite string) ([]*batchv1.Job, error) {
+	return c.listJobsBy(labels.SelectorFromSet(labels.Set{
+		labelEvalOf:    jobName,
+		labelEvalSuite: suite,
+	}))
+}
+
+func (c *jobCache) listPods(jobName string) ([]*corev1.Pod, error) {
+	return c.listPodsBy(labels.SelectorFromSet(labels.Set{labelJobName: jobName}))
+}
+
+// listPodsByJob groups the pods of all the jobs by the job
+func (c *jobCache) listPodsByJob() (map[string][]*corev1.Pod, error) {
+	selector, err := labels.Parse(labelJobName)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := c.listPodsBy(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	r := map[string][]*corev1.Pod{}
+	for _, pod := range v {
+		name := pod.Labels[labelJobName]
+		r[name] = append(r[name], pod)
+	}
+
+	return r, nil
+}
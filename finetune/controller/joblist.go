@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+const (
+	// headerContinue carries the token of the next page of jobs
+	headerContinue = "X-Continue"
+
+	orderAsc  = "asc"
+	orderDesc = "desc"
+
+	maxListLimit = 500
+)
+
+// jobListOption is the filters, order and page of listing jobs which are passed by query
+type jobListOption struct {
+	Username      string
+	Model         string
+	Dataset       string
+	Status        string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Order         string
+	Limit         int
+	Continue      *listCursor
+}
+
+// listCursor is the last job of the previous page
+type listCursor struct {
+	CreatedAt time.Time `json:"t"`
+	Name      string    `json:"n"`
+	Order     string    `json:"o"`
+}
+
+func (cur *listCursor) encode() string {
+	b, _ := json.Marshal(cur)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeListCursor(s string) (*listCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	cur := new(listCursor)
+	if err := json.Unmarshal(b, cur); err != nil {
+		return nil, err
+	}
+
+	return cur, nil
+}
+
+func parseJobListOption(c *gin.Context) (opt jobListOption, err error) {
+	opt.Username = c.Query("username")
+	opt.Model = c.Query("model")
+	opt.Dataset = c.Query("dataset")
+	opt.Status = c.Query("status")
+
+	if v := c.Query("created_after"); v != "" {
+		if opt.CreatedAfter, err = time.Parse(time.RFC3339, v); err != nil {
+			err = fmt.Errorf("invalid created_after")
+
+			return
+		}
+	}
+
+	if v := c.Query("created_before"); v != "" {
+		if opt.CreatedBefore, err = time.Parse(time.RFC3339, v); err != nil {
+			err = fmt.Errorf("invalid created_before")
+
+			return
+		}
+	}
+
+	switch opt.Order = c.DefaultQuery("order", orderAsc); opt.Order {
+	case orderAsc, orderDesc:
+	default:
+		err = fmt.Errorf("invalid order")
+
+		return
+	}
+
+	if v := c.Query("limit"); v != "" {
+		if opt.Limit, err = strconv.Atoi(v); err != nil || opt.Limit <= 0 || opt.Limit > maxListLimit {
+			err = fmt.Errorf("invalid limit, it should be in [1, %d]", maxListLimit)
+
+			return
+		}
+	}
+
+	if v := c.Query("continue"); v != "" {
+		if opt.Continue, err = decodeListCursor(v); err != nil || opt.Continue.Order != opt.Order {
+			err = fmt.Errorf("invalid continue")
+		}
+	}
+
+	return
+}
+
+func (opt *jobListOption) match(job *batchv1.Job) bool {
+	created := job.CreationTimestamp.Time
+
+	switch {
+	case opt.Username != "" && job.Labels["create_by"] != opt.Username:
+		return false
+	case opt.Model != "" && job.Labels["model"] != opt.Model:
+		return false
+	case opt.Dataset != "" && job.Labels["data"] != opt.Dataset:
+		return false
+	case opt.Status != "" && jobStatus(job) != opt.Status:
+		return false
+	case !opt.CreatedAfter.IsZero() && created.Before(opt.CreatedAfter):
+		return false
+	case !opt.CreatedBefore.IsZero() && !created.Before(opt.CreatedBefore):
+		return false
+	}
+
+	return true
+}
+
+// afterCursor checks whether the job is behind the cursor in the order
+func (opt *jobListOption) afterCursor(job *batchv1.Job) bool {
+	cur := opt.Continue
+	if cur == nil {
+		return true
+	}
+
+	created := job.CreationTimestamp.Time
+	if !created.Equal(cur.CreatedAt) {
+		return created.After(cur.CreatedAt) == (opt.Order == orderAsc)
+	}
+
+	return job.Name != cur.Name && (job.Name > cur.Name) == (opt.Order == orderAsc)
+}
+
+// filterJobs returns a page of the jobs which are sorted from the oldest to the newest,
+// and the cursor of the next page if there are more.
+func filterJobs(items []*batchv1.Job, opt *jobListOption) ([]*batchv1.Job, *listCursor) {
+	r := []*batchv1.Job{}
+
+	for i := range items {
+		job := items[i]
+		if opt.Order == orderDesc {
+			job = items[len(items)-1-i]
+		}
+
+		if !opt.match(job) || !opt.afterCursor(job) {
+			continue
+		}
+
+		if opt.Limit > 0 && len(r) == opt.Limit {
+			last := r[len(r)-1]
+
+			return r, &listCursor{
+				CreatedAt: last.CreationTimestamp.Time,
+				Name:      last.Name,
+				Order:     opt.Order,
+			}
+		}
+
+		r = append(r, job)
+	}
+
+	return r, nil
+}
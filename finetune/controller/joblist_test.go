@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFilterJobs(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newJob := func(name, user string, minutes int) *batchv1.Job {
+		return &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Labels:            map[string]string{"create_by": user},
+			CreationTimestamp: metav1.NewTime(base.Add(time.Duration(minutes) * time.Minute)),
+		}}
+	}
+
+	// the jobs are sorted from the oldest to the newest, b and c are created at the same time
+	items := []*batchv1.Job{
+		newJob("a", "alice", 0),
+		newJob("b", "bob", 1),
+		newJob("c", "alice", 1),
+		newJob("d", "alice", 2),
+	}
+
+	cases := []struct {
+		name string
+		opt  jobListOption
+		// pages are the names of jobs in every page which is read by the cursor of the previous one
+		pages [][]string
+	}{
+		{
+			name:  "all",
+			opt:   jobListOption{Order: orderAsc},
+			pages: [][]string{{"a", "b", "c", "d"}},
+		},
+		{
+			name:  "pages in asc",
+			opt:   jobListOption{Order: orderAsc, Limit: 2},
+			pages: [][]string{{"a", "b"}, {"c", "d"}},
+		},
+		{
+			name:  "pages in desc",
+			opt:   jobListOption{Order: orderDesc, Limit: 3},
+			pages: [][]string{{"d", "c", "b"}, {"a"}},
+		},
+		{
+			name:  "username",
+			opt:   jobListOption{Order: orderAsc, Username: "alice", Limit: 1},
+			pages: [][]string{{"a"}, {"c"}, {"d"}},
+		},
+		{
+			name:  "created range",
+			opt:   jobListOption{Order: orderAsc, CreatedAfter: base.Add(time.Minute), CreatedBefore: base.Add(2 * time.Minute)},
+			pages: [][]string{{"b", "c"}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opt := tc.opt
+
+			for i, want := range tc.pages {
+				page, cur := filterJobs(items, &opt)
+
+				got := make([]string, len(page))
+				for j := range page {
+					got[j] = page[j].Name
+				}
+
+				if !reflect.DeepEqual(got, want) {
+					t.Fatalf("page %d: got %v, want %v", i, got, want)
+				}
+
+				if (cur == nil) != (i == len(tc.pages)-1) {
+					t.Fatalf("page %d: unexpected cursor %v", i, cur)
+				}
+
+				if cur != nil {
+					// the cursor is passed to the client and back
+					if opt.Continue, _ = decodeListCursor(cur.encode()); opt.Continue == nil {
+						t.Fatalf("page %d: invalid cursor", i)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opensourceways/foundation-model-server/allerror"
+	commonctl "github.com/opensourceways/foundation-model-server/common/controller"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	logs    logStore
+	logsCfg LogsConfig
+)
+
+// logStore archives the logs of jobs so that they are available after the pods are deleted
+type logStore interface {
+	Write(jobName string, line []byte) error
+	// Close is called when there will be no more logs of the job
+	Close(jobName string)
+	Exists(jobName string) bool
+	Read(jobName string, opt *logReadOption, w io.Writer) error
+	Delete(jobName string) error
+}
+
+// logReadOption is the byte range of the archived logs
+type logReadOption struct {
+	Offset int64
+	Limit  int64
+}
+
+// LogsConfig
+type LogsConfig struct {
+	Dir string `json:"dir"`
+	// MaxFileSize is the max size of a log file, the file is rotated if exceeded
+	MaxFileSize int64 `json:"max_file_size"`
+	// MaxJobSize is the max size of all the logs of a job, the oldest files are removed if exceeded
+	MaxJobSize int64 `json:"max_job_size"`
+	// AllowedOrigins are the origins allowed to watch logs by websocket, "*" allows all
+	AllowedOrigins []string `json:"allowed_origins"`
+}
+
+func (cfg *LogsConfig) setDefault() {
+	if cfg.Dir == "" {
+		cfg.Dir = "/data/disk1/logs"
+	}
+
+	if cfg.MaxFileSize <= 0 {
+		cfg.MaxFileSize = 10 << 20
+	}
+
+	if cfg.MaxJobSize <= 0 {
+		cfg.MaxJobSize = 100 << 20
+	}
+}
+
+func (cfg *LogsConfig) validate() error {
+	if cfg.MaxFileSize > cfg.MaxJobSize {
+		return errors.New("max_file_size of logs must not be greater than max_job_size")
+	}
+
+	return nil
+}
+
+func parseLogReadOption(c *gin.Context) (opt logReadOption, err error) {
+	if v := c.Query("offset"); v != "" {
+		if opt.Offset, err = strconv.ParseInt(v, 10, 64); err != nil || opt.Offset < 0 {
+			err = fmt.Errorf("invalid offset")
+
+			return
+		}
+	}
+
+	if v := c.Query("limit"); v != "" {
+		if opt.Limit, err = strconv.ParseInt(v, 10, 64); err != nil || opt.Limit < 0 {
+			err = fmt.Errorf("invalid limit")
+		}
+	}
+
+	return
+}
+
+// archivedLogs decides whether the logs of job should be read from the archive
+func archivedLogs(jobName string) (bool, error) {
+	job, err := getJob(jobName)
+	if err != nil {
+		if !isNotFound(err) {
+			return false, err
+		}
+
+		if !logs.Exists(jobName) {
+			return false, allerror.NewNotFound(fmt.Sprintf("no logs of job %s", jobName))
+		}
+
+		return true, nil
+	}
+
+	// the logs of jobs which finished before archiving was enabled are still read from the pods
+	return isTerminalStatus(jobStatus(job)) && !collectors.isRunning(jobName) && logs.Exists(jobName), nil
+}
+
+// sendArchivedLogs sends the archived logs line by line
+func sendArchivedLogs(sender logSender, jobName string, opt *logStreamOption) error {
+	f := newArchiveLineFilter(opt, sender)
+
+	if err := logs.Read(jobName, &logReadOption{}, f); err != nil {
+		return err
+	}
+
+	return f.flush()
+}
+
+// @Summary		Logs
+// @Description	get the archived logs of a finetune job
+// @Tags			Finetune
+// @Param			jobname	path	string	true	"finetune id"
+// @Param			offset			query	int		false	"byte offset in the archive"
+// @Param			limit			query	int		false	"max bytes"
+// @Param			tailLines		query	int		false	"number of lines from the end"
+// @Param			sinceSeconds	query	int		false	"only the logs newer than it"
+// @Param			timestamps		query	bool	false	"add timestamp to every line"
+// @Success		200	{object}		string
+// @Failure		500	system_error	system	error
+// @Router			/v1/job/{jobname}/logs [get]
+func getArchivedJobLogs(c *gin.Context) {
+	jobName := c.Param("jobname")
+
+	opt, err := parseLogReadOption(c)
+	if err != nil {
+		commonctl.SendBadRequestParam(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	streamOpt, err := parseLogStreamOption(c)
+	if err != nil {
+		commonctl.SendBadRequestParam(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	if !logs.Exists(jobName) {
+		err := allerror.NewNotFound(fmt.Sprintf("no logs of job %s", jobName))
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	// the byte range is read from the archive as it is
+	if opt.Offset > 0 || opt.Limit > 0 {
+		err = logs.Read(jobName, &opt, c.Writer)
+	} else {
+		f := newArchiveLineFilter(&streamOpt, &plainLogSender{w: c.Writer})
+
+		if err = logs.Read(jobName, &opt, f); err == nil {
+			err = f.flush()
+		}
+	}
+
+	if err != nil {
+		logrus.Errorf("read logs of job %s failed, err:%s", jobName, err.Error())
+	}
+}
@@ -0,0 +1,304 @@
+package controller
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/opensourceways/foundation-model-server/allerror"
+)
+
+const logSegmentSuffix = ".log"
+
+// localLogStore saves the logs of every job as rotated segment files in a directory of the job
+type localLogStore struct {
+	cfg     LogsConfig
+	mutex   sync.Mutex
+	writers map[string]*logWriter
+}
+
+func newLocalLogStore(cfg *LogsConfig) (*localLogStore, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &localLogStore{
+		cfg:     *cfg,
+		writers: map[string]*logWriter{},
+	}, nil
+}
+
+func (s *localLogStore) jobDir(jobName string) (string, error) {
+	if _, err := uuid.Parse(jobName); err != nil {
+		return "", allerror.New(allerror.ErrorBadRequestParam, fmt.Sprintf("invalid job: %s", jobName))
+	}
+
+	return filepath.Join(s.cfg.Dir, jobName), nil
+}
+
+// segments returns the segment files of job from the oldest to the newest
+func (s *localLogStore) segments(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+logSegmentSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+func (s *localLogStore) writer(jobName string) (*logWriter, error) {
+	if w, ok := s.writers[jobName]; ok {
+		return w, nil
+	}
+
+	dir, err := s.jobDir(jobName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	segments, err := s.segments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &logWriter{dir: dir}
+	for _, f := range segments {
+		info, err := os.Stat(f)
+		if err != nil {
+			return nil, err
+		}
+
+		w.segments = append(w.segments, logSegment{path: f, size: info.Size()})
+		w.total += info.Size()
+	}
+
+	s.writers[jobName] = w
+
+	return w, nil
+}
+
+func (s *localLogStore) Write(jobName string, line []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	w, err := s.writer(jobName)
+	if err != nil {
+		return err
+	}
+
+	// the line is copied, appending to it may write into the buffer of caller
+	b := make([]byte, len(line)+1)
+	copy(b, line)
+	b[len(line)] = '\n'
+
+	return w.write(b, &s.cfg)
+}
+
+func (s *localLogStore) Close(jobName string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if w, ok := s.writers[jobName]; ok {
+		w.close()
+		delete(s.writers, jobName)
+	}
+}
+
+func (s *localLogStore) Exists(jobName string) bool {
+	dir, err := s.jobDir(jobName)
+	if err != nil {
+		return false
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	segments, err := s.segments(dir)
+
+	return err == nil && len(segments) > 0
+}
+
+func (s *localLogStore) Read(jobName string, opt *logReadOption, w io.Writer) error {
+	dir, err := s.jobDir(jobName)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	segments, err := s.segments(dir)
+	if lw, ok := s.writers[jobName]; ok && err == nil {
+		err = lw.flush()
+	}
+	s.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	if len(segments) == 0 {
+		return allerror.NewNotFound(fmt.Sprintf("no logs of job %s", jobName))
+	}
+
+	readers := make([]io.Reader, 0, len(segments))
+	for _, f := range segments {
+		file, err := os.Open(f)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// it is removed by rotation
+				continue
+			}
+
+			return err
+		}
+		defer file.Close()
+
+		readers = append(readers, file)
+	}
+
+	r := io.MultiReader(readers...)
+
+	if opt.Offset > 0 {
+		if _, err := io.CopyN(io.Discard, r, opt.Offset); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return err
+		}
+	}
+
+	if opt.Limit > 0 {
+		r = io.LimitReader(r, opt.Limit)
+	}
+
+	_, err = io.Copy(w, r)
+
+	return err
+}
+
+func (s *localLogStore) Delete(jobName string) error {
+	dir, err := s.jobDir(jobName)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if w, ok := s.writers[jobName]; ok {
+		w.close()
+		delete(s.writers, jobName)
+	}
+
+	return os.RemoveAll(dir)
+}
+
+type logSegment struct {
+	path string
+	size int64
+}
+
+// logWriter appends to the newest segment and rotates the segments by size
+type logWriter struct {
+	dir      string
+	segments []logSegment
+	total    int64
+	file     *os.File
+	buf      *bufio.Writer
+}
+
+func (w *logWriter) write(b []byte, cfg *LogsConfig) error {
+	n := len(w.segments)
+	if n == 0 || w.segments[n-1].size+int64(len(b)) > cfg.MaxFileSize {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.buf.Write(b); err != nil {
+		return err
+	}
+
+	w.segments[len(w.segments)-1].size += int64(len(b))
+	w.total += int64(len(b))
+
+	// drop the oldest segments when the logs are too large
+	for w.total > cfg.MaxJobSize && len(w.segments) > 1 {
+		if err := os.Remove(w.segments[0].path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		w.total -= w.segments[0].size
+		w.segments = w.segments[1:]
+	}
+
+	return nil
+}
+
+func (w *logWriter) rotate() error {
+	w.close()
+
+	index := 0
+	if n := len(w.segments); n > 0 {
+		if _, err := fmt.Sscanf(filepath.Base(w.segments[n-1].path), "%d", &index); err != nil {
+			return err
+		}
+
+		index++
+	}
+
+	w.segments = append(w.segments, logSegment{
+		path: filepath.Join(w.dir, fmt.Sprintf("%08d%s", index, logSegmentSuffix)),
+	})
+
+	return w.open()
+}
+
+func (w *logWriter) open() error {
+	f, err := os.OpenFile(w.segments[len(w.segments)-1].path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	w.file = f
+	w.buf = bufio.NewWriter(f)
+
+	return nil
+}
+
+func (w *logWriter) flush() error {
+	if w.buf == nil {
+		return nil
+	}
+
+	return w.buf.Flush()
+}
+
+func (w *logWriter) close() {
+	if w.file == nil {
+		return
+	}
+
+	w.flush()
+	w.file.Close()
+
+	w.file = nil
+	w.buf = nil
+}
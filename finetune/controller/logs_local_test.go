@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestLocalLogStoreWrite(t *testing.T) {
+	cfg := LogsConfig{Dir: t.TempDir()}
+	cfg.setDefault()
+
+	s, err := newLocalLogStore(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobName := uuid.New().String()
+	defer s.Close(jobName)
+
+	// the lines share a buffer which has room after each of them
+	buf := []byte("firstsecond")
+	first, second := buf[:5:len(buf)], buf[5:]
+
+	if err := s.Write(jobName, first); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(second) != "second" {
+		t.Fatalf("the buffer of caller is changed to %q", buf)
+	}
+
+	if err := s.Write(jobName, second); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := s.Read(jobName, &logReadOption{}, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.String() != "first\nsecond\n" {
+		t.Errorf("logs = %q", out.String())
+	}
+}
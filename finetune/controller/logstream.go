@@ -0,0 +1,446 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	sseEventLog     = "log"
+	sseEventSegment = "segment"
+	sseEventClose   = "close"
+)
+
+// logSegmentInfo starts the logs of a pod
+type logSegmentInfo struct {
+	Pod     string `json:"pod"`
+	Attempt int    `json:"attempt"`
+}
+
+// logStreamOption is the options of streaming logs which are passed by query
+type logStreamOption struct {
+	TailLines    *int64
+	SinceSeconds *int64
+	Timestamps   bool
+	Follow       bool
+}
+
+func parseLogStreamOption(c *gin.Context) (opt logStreamOption, err error) {
+	opt.Follow = true
+
+	if v := c.Query("tailLines"); v != "" {
+		n, err1 := strconv.ParseInt(v, 10, 64)
+		if err1 != nil || n < 0 {
+			err = fmt.Errorf("invalid tailLines")
+
+			return
+		}
+		opt.TailLines = &n
+	}
+
+	if v := c.Query("sinceSeconds"); v != "" {
+		n, err1 := strconv.ParseInt(v, 10, 64)
+		if err1 != nil || n <= 0 {
+			err = fmt.Errorf("invalid sinceSeconds")
+
+			return
+		}
+		opt.SinceSeconds = &n
+	}
+
+	if v := c.Query("timestamps"); v != "" {
+		if opt.Timestamps, err = strconv.ParseBool(v); err != nil {
+			err = fmt.Errorf("invalid timestamps")
+
+			return
+		}
+	}
+
+	if v := c.Query("follow"); v != "" {
+		if opt.Follow, err = strconv.ParseBool(v); err != nil {
+			err = fmt.Errorf("invalid follow")
+		}
+	}
+
+	return
+}
+
+func (opt *logStreamOption) podLogOptions() *corev1.PodLogOptions {
+	return &corev1.PodLogOptions{
+		Follow:       opt.Follow,
+		TailLines:    opt.TailLines,
+		SinceSeconds: opt.SinceSeconds,
+		Timestamps:   opt.Timestamps,
+	}
+}
+
+// splitTimestamp splits the line prefixed with the timestamp of kubernetes
+func splitTimestamp(line []byte) (time.Time, []byte, bool) {
+	i := bytes.IndexByte(line, ' ')
+	if i <= 0 {
+		return time.Time{}, line, false
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, string(line[:i]))
+	if err != nil {
+		return time.Time{}, line, false
+	}
+
+	return t, line[i+1:], true
+}
+
+type archivedLine struct {
+	line    []byte
+	segment *logSegmentInfo
+}
+
+// archiveLineFilter applies the stream options to the archived lines
+type archiveLineFilter struct {
+	opt    *logStreamOption
+	since  time.Time
+	sender logSender
+	tail   []archivedLine
+	buf    []byte
+}
+
+func newArchiveLineFilter(opt *logStreamOption, sender logSender) *archiveLineFilter {
+	f := &archiveLineFilter{opt: opt, sender: sender}
+	if opt.SinceSeconds != nil {
+		f.since = time.Now().Add(-time.Duration(*opt.SinceSeconds) * time.Second)
+	}
+
+	return f
+}
+
+func (f *archiveLineFilter) Write(b []byte) (int, error) {
+	f.buf = append(f.buf, b...)
+
+	for {
+		i := bytes.IndexByte(f.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := append([]byte(nil), f.buf[:i+1]...)
+		f.buf = f.buf[i+1:]
+
+		if err := f.handle(line); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+func (f *archiveLineFilter) handle(line []byte) error {
+	if pod, attempt, ok := parseSegmentMarker(line); ok {
+		return f.output(archivedLine{segment: &logSegmentInfo{Pod: pod, Attempt: attempt}})
+	}
+
+	t, content, ok := splitTimestamp(line)
+	if ok && !f.since.IsZero() && t.Before(f.since) {
+		return nil
+	}
+
+	if !f.opt.Timestamps {
+		line = content
+	}
+
+	return f.output(archivedLine{line: line})
+}
+
+func (f *archiveLineFilter) output(v archivedLine) error {
+	if f.opt.TailLines == nil {
+		return f.send(&v)
+	}
+
+	f.tail = append(f.tail, v)
+	if v.segment != nil {
+		return nil
+	}
+
+	n, lines := int(*f.opt.TailLines), 0
+	for i := len(f.tail) - 1; i >= 0; i-- {
+		if f.tail[i].segment == nil {
+			lines++
+		}
+
+		if lines <= n {
+			continue
+		}
+
+		// the segment of the first line in the tail is kept
+		rest := f.tail[i+1:]
+		if len(rest) > 0 && rest[0].segment == nil {
+			for j := i; j >= 0; j-- {
+				if f.tail[j].segment != nil {
+					rest = append([]archivedLine{f.tail[j]}, rest...)
+					break
+				}
+			}
+		}
+		f.tail = rest
+
+		break
+	}
+
+	return nil
+}
+
+func (f *archiveLineFilter) send(v *archivedLine) error {
+	if v.segment != nil {
+		return f.sender.segment(v.segment.Pod, v.segment.Attempt)
+	}
+
+	return f.sender.send(v.line)
+}
+
+// flush sends the rest lines, it must be called at the end
+func (f *archiveLineFilter) flush() error {
+	if len(f.buf) > 0 {
+		if err := f.handle(append(f.buf, '\n')); err != nil {
+			return err
+		}
+		f.buf = nil
+	}
+
+	for i := range f.tail {
+		if err := f.send(&f.tail[i]); err != nil {
+			return err
+		}
+	}
+	f.tail = nil
+
+	return nil
+}
+
+// logSender sends the logs to the client over a transport
+type logSender interface {
+	send(line []byte) error
+	// segment is sent before the logs of a pod
+	segment(pod string, attempt int) error
+	// close ends the stream with the final status of job or the error
+	close(status string, err error)
+}
+
+// wsLogSender sends every line as a binary message of websocket
+type wsLogSender struct {
+	ws    *websocket.Conn
+	mutex sync.Mutex
+	// done stops pinging when the stream is closed
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newWSLogSender(ws *websocket.Conn) *wsLogSender {
+	s := &wsLogSender{ws: ws, done: make(chan struct{})}
+	go s.ping()
+
+	return s
+}
+
+func (s *wsLogSender) ping() {
+	ticker := time.NewTicker(60 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+
+		case <-ticker.C:
+			s.mutex.Lock()
+			err := s.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
+			s.mutex.Unlock()
+
+			if err != nil {
+				logrus.Infoln("Write ping error:", err)
+			}
+		}
+	}
+}
+
+func (s *wsLogSender) send(line []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.ws.WriteMessage(websocket.BinaryMessage, line)
+}
+
+// writeJSON sends the value as a text message
+func (s *wsLogSender) writeJSON(v interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.ws.WriteJSON(v)
+}
+
+// segment is sent as a text message to be distinguished from the logs
+func (s *wsLogSender) segment(pod string, attempt int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.ws.WriteJSON(&logSegmentInfo{Pod: pod, Attempt: attempt})
+}
+
+func (s *wsLogSender) close(status string, err error) {
+	s.closeOnce.Do(func() { close(s.done) })
+
+	code, reason := websocket.CloseNormalClosure, status
+	if err != nil {
+		code, reason = websocket.CloseInternalServerErr, err.Error()
+	}
+
+	// the reason of close message can't be longer than 123 bytes
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	msg := websocket.FormatCloseMessage(code, reason)
+	if err := s.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(10*time.Second)); err != nil {
+		logrus.Warningf("write close message failed: %s", err.Error())
+	}
+}
+
+// sseLogSender sends every line as a server-sent event
+type sseLogSender struct {
+	c *gin.Context
+}
+
+func newSSELogSender(c *gin.Context) *sseLogSender {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	return &sseLogSender{c: c}
+}
+
+// sseLogEvent returns the event of line, every piece of the line split by the carriage
+// returns or the line feeds is a data field, so the client can't be confused by a line feed
+// in the data. The empty pieces are kept, they are the blank lines of the output.
+func sseLogEvent(line []byte) string {
+	v := strings.ReplaceAll(strings.TrimRight(string(line), "\r\n"), "\r\n", "\n")
+	pieces := strings.Split(strings.ReplaceAll(v, "\r", "\n"), "\n")
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "event: %s\n", sseEventLog)
+	for _, v := range pieces {
+		fmt.Fprintf(&b, "data: %s\n", v)
+	}
+	b.WriteString("\n")
+
+	return b.String()
+}
+
+func (s *sseLogSender) send(line []byte) error {
+	if _, err := io.WriteString(s.c.Writer, sseLogEvent(line)); err != nil {
+		return err
+	}
+
+	s.c.Writer.Flush()
+
+	return nil
+}
+
+func (s *sseLogSender) segment(pod string, attempt int) error {
+	b, err := json.Marshal(&logSegmentInfo{Pod: pod, Attempt: attempt})
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(s.c.Writer, "event: %s\ndata: %s\n\n", sseEventSegment, b); err != nil {
+		return err
+	}
+
+	s.c.Writer.Flush()
+
+	return nil
+}
+
+func (s *sseLogSender) close(status string, err error) {
+	v := map[string]string{"status": status}
+	if err != nil {
+		v["error"] = err.Error()
+	}
+
+	b, _ := json.Marshal(v)
+
+	fmt.Fprintf(s.c.Writer, "event: %s\ndata: %s\n\n", sseEventClose, b)
+	s.c.Writer.Flush()
+}
+
+// plainLogSender writes the logs as plain text
+type plainLogSender struct {
+	w io.Writer
+}
+
+func (s *plainLogSender) send(line []byte) error {
+	_, err := s.w.Write(line)
+
+	return err
+}
+
+func (s *plainLogSender) segment(pod string, attempt int) error {
+	_, err := fmt.Fprintf(s.w, "==> pod %s (attempt %d) <==\n", pod, attempt)
+
+	return err
+}
+
+func (s *plainLogSender) close(string, error) {}
+
+func wantSSE(c *gin.Context) bool {
+	return c.Query("transport") == "sse" || strings.Contains(c.GetHeader("Accept"), "text/event-stream")
+}
+
+func newUpgrader() *websocket.Upgrader {
+	return &websocket.Upgrader{
+		CheckOrigin: checkOrigin,
+	}
+}
+
+// checkOrigin allows the origins in the config, the same origin is allowed only if it is empty
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	for _, v := range logsCfg.AllowedOrigins {
+		if v == "*" || v == origin {
+			return true
+		}
+	}
+
+	return strings.EqualFold(strings.TrimPrefix(strings.TrimPrefix(origin, "https://"), "http://"), r.Host)
+}
+
+// finalJobStatus returns the status of job after the stream ended
+func finalJobStatus(jobName string) string {
+	job, err := getJob(jobName)
+	if err != nil {
+		if isNotFound(err) {
+			return "Deleted"
+		}
+
+		return ""
+	}
+
+	return jobStatus(job)
+}
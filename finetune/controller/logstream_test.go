@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// recordSender records the lines and segments which are sent
+type recordSender struct {
+	items []string
+}
+
+func (s *recordSender) send(line []byte) error {
+	s.items = append(s.items, string(line))
+
+	return nil
+}
+
+func (s *recordSender) segment(pod string, attempt int) error {
+	s.items = append(s.items, fmt.Sprintf("segment %s/%d", pod, attempt))
+
+	return nil
+}
+
+func (s *recordSender) close(string, error) {}
+
+func TestArchiveLineFilter(t *testing.T) {
+	now := time.Now().UTC()
+	old := now.Add(-2 * time.Hour).Format(time.RFC3339Nano)
+	recent := now.Format(time.RFC3339Nano)
+
+	// the last line has no line feed
+	archive := string(segmentMarkerLine("p0", 1)) + "\n" +
+		old + " a\n" +
+		old + " b\n" +
+		string(segmentMarkerLine("p1", 2)) + "\n" +
+		recent + " c\n" +
+		recent + " d"
+
+	int64p := func(n int64) *int64 { return &n }
+
+	cases := []struct {
+		name string
+		opt  logStreamOption
+		want []string
+	}{
+		{
+			name: "all lines",
+			want: []string{"segment p0/1", "a\n", "b\n", "segment p1/2", "c\n", "d\n"},
+		},
+		{
+			name: "timestamps",
+			opt:  logStreamOption{Timestamps: true},
+			want: []string{
+				"segment p0/1", old + " a\n", old + " b\n", "segment p1/2", recent + " c\n", recent + " d\n",
+			},
+		},
+		{
+			name: "tail in the last segment",
+			opt:  logStreamOption{TailLines: int64p(2)},
+			want: []string{"segment p1/2", "c\n", "d\n"},
+		},
+		{
+			name: "tail keeps the segment of its first line",
+			opt:  logStreamOption{TailLines: int64p(3)},
+			want: []string{"segment p0/1", "b\n", "segment p1/2", "c\n", "d\n"},
+		},
+		{
+			name: "tail more than the lines",
+			opt:  logStreamOption{TailLines: int64p(10)},
+			want: []string{"segment p0/1", "a\n", "b\n", "segment p1/2", "c\n", "d\n"},
+		},
+		{
+			name: "no tail",
+			opt:  logStreamOption{TailLines: int64p(0)},
+			want: nil,
+		},
+		{
+			name: "since",
+			opt:  logStreamOption{SinceSeconds: int64p(3600)},
+			want: []string{"segment p0/1", "segment p1/2", "c\n", "d\n"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sender := &recordSender{}
+			f := newArchiveLineFilter(&tc.opt, sender)
+
+			// the lines are split across the writes
+			b := []byte(archive)
+			for len(b) > 0 {
+				n := 7
+				if n > len(b) {
+					n = len(b)
+				}
+
+				if _, err := f.Write(b[:n]); err != nil {
+					t.Fatal(err)
+				}
+				b = b[n:]
+			}
+
+			if err := f.flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(sender.items, tc.want) {
+				t.Errorf("got %q, want %q", sender.items, tc.want)
+			}
+		})
+	}
+}
+
+func TestSSELogEvent(t *testing.T) {
+	cases := []struct {
+		line string
+		want []string
+	}{
+		{"step 1\n", []string{"step 1"}},
+		{"", []string{""}},
+		// the progress bars are redrawn by the carriage returns
+		{"10%\r20%\r30%\n", []string{"10%", "20%", "30%"}},
+		// the blank lines are kept
+		{"a\n\nb\r\n\r\nc", []string{"a", "", "b", "", "c"}},
+		{"a\r\nb\r\n", []string{"a", "b"}},
+		{"a\r", []string{"a"}},
+	}
+
+	for _, tc := range cases {
+		want := "event: " + sseEventLog + "\n"
+		for _, v := range tc.want {
+			want += "data: " + v + "\n"
+		}
+		want += "\n"
+
+		if got := sseLogEvent([]byte(tc.line)); got != want {
+			t.Errorf("sseLogEvent(%q) = %q, want %q", tc.line, got, want)
+		}
+	}
+}
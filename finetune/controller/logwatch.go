@@ -0,0 +1,327 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// segmentMarker prefixes the line in the archive which starts the logs of a pod
+	segmentMarker = "### finetune-segment "
+
+	watchJobInterval = 5 * time.Second
+)
+
+var errStreamClosed = errors.New("stream closed")
+
+func segmentMarkerLine(pod string, attempt int) []byte {
+	return []byte(fmt.Sprintf("%spod=%s attempt=%d", segmentMarker, pod, attempt))
+}
+
+func parseSegmentMarker(line []byte) (pod string, attempt int, ok bool) {
+	n, err := fmt.Sscanf(string(line), segmentMarker+"pod=%s attempt=%d", &pod, &attempt)
+
+	return pod, attempt, err == nil && n == 2
+}
+
+// sortPods sorts the pods by the creation time, the index of a pod is the attempt of job
+func sortPods(pods []*corev1.Pod) []*corev1.Pod {
+	r := append([]*corev1.Pod(nil), pods...)
+
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].CreationTimestamp.Equal(&r[j].CreationTimestamp) {
+			return r[i].Name < r[j].Name
+		}
+
+		return r[i].CreationTimestamp.Before(&r[j].CreationTimestamp)
+	})
+
+	return r
+}
+
+func isPodStarted(pod *corev1.Pod) bool {
+	return pod.Status.Phase != corev1.PodPending && pod.Status.Phase != corev1.PodUnknown
+}
+
+// jobPodWatcher tracks the pods of a job in the cache, including the ones created by retries
+type jobPodWatcher struct {
+	cluster *cluster
+	jobName string
+	pods    map[string]*corev1.Pod
+}
+
+// refresh updates the pods from the cache
+func (pw *jobPodWatcher) refresh() error {
+	pods, err := jobs.listPods(pw.jobName)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]bool, len(pods))
+	for _, pod := range pods {
+		pw.pods[pod.Name] = pod
+		current[pod.Name] = true
+	}
+
+	// the pod deleted before starting has no logs
+	for name, pod := range pw.pods {
+		if !current[name] && !isPodStarted(pod) {
+			delete(pw.pods, name)
+		}
+	}
+
+	return nil
+}
+
+// streamPods starts streaming the logs of the started pods which are not streamed yet. The
+// pods are streamed at the same time if the option of follow is set, so the logs of every
+// rank of a multi-node job are sent while they are running, otherwise one after another
+// in the order of attempts.
+func (pw *jobPodWatcher) streamPods(streams *podStreams, opt *logStreamOption) {
+	pods := make([]*corev1.Pod, 0, len(pw.pods))
+	for _, p := range pw.pods {
+		pods = append(pods, p)
+	}
+
+	sorted := sortPods(pods)
+	attempts := podAttempts(sorted)
+
+	for _, pod := range sorted {
+		if !isPodStarted(pod) || !streams.start(pod.Name, attempts[pod.Name]) {
+			continue
+		}
+
+		if !opt.Follow {
+			streams.wait()
+		}
+	}
+}
+
+// mergedLogSender sends the logs of the pods streamed at the same time to the sender,
+// the segment of a pod is sent before its lines whenever they follow the ones of another pod.
+type mergedLogSender struct {
+	sender logSender
+
+	mutex   sync.Mutex
+	current string
+}
+
+func (m *mergedLogSender) send(pod string, attempt int, line []byte) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.current != pod {
+		if err := m.sender.segment(pod, attempt); err != nil {
+			return err
+		}
+		m.current = pod
+	}
+
+	return m.sender.send(line)
+}
+
+// podLogSender sends the logs of a pod through the merged sender
+type podLogSender struct {
+	merged  *mergedLogSender
+	pod     string
+	attempt int
+}
+
+func (s *podLogSender) send(line []byte) error {
+	return s.merged.send(s.pod, s.attempt, line)
+}
+
+func (s *podLogSender) segment(string, int) error { return nil }
+
+func (s *podLogSender) close(string, error) {}
+
+// podStreams streams the logs of the pods of a job, every pod is streamed once.
+// All the streams stop if one of them fails.
+type podStreams struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	cluster *cluster
+	opt     *logStreamOption
+	sender  *mergedLogSender
+
+	wg      sync.WaitGroup
+	mutex   sync.Mutex
+	started map[string]bool
+	err     error
+}
+
+func newPodStreams(cl *cluster, sender logSender, opt *logStreamOption) *podStreams {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &podStreams{
+		ctx:     ctx,
+		cancel:  cancel,
+		cluster: cl,
+		opt:     opt,
+		sender:  &mergedLogSender{sender: sender},
+		started: map[string]bool{},
+	}
+}
+
+// start streams the logs of pod in background, it returns false if the pod has been streamed
+func (s *podStreams) start(pod string, attempt int) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.started[pod] || s.err != nil {
+		return false
+	}
+	s.started[pod] = true
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		sender := &podLogSender{merged: s.sender, pod: pod, attempt: attempt}
+		if err := streamPodLogs(s.ctx, sender, s.cluster, pod, s.opt); err != nil {
+			s.fail(err)
+		}
+	}()
+
+	return true
+}
+
+func (s *podStreams) fail(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.err == nil {
+		s.err = err
+		s.cancel()
+	}
+}
+
+// failed returns the error of the first stream which failed
+func (s *podStreams) failed() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.err
+}
+
+// wait waits for the streams which are started and returns the error of the first failed one
+func (s *podStreams) wait() error {
+	s.wg.Wait()
+
+	return s.failed()
+}
+
+// stop cancels the streams and waits for them
+func (s *podStreams) stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// doWatchJob streams the logs of every pod of job. It follows the pods created
+// by retries until the job finishes if the option of follow is set.
+func doWatchJob(sender logSender, jobName string, opt *logStreamOption) error {
+	job, err := getJob(jobName)
+	if err != nil {
+		logrus.Error(err.Error())
+		return fmt.Errorf("get job failed")
+	}
+
+	cl, err := clusterOf(job)
+	if err != nil {
+		logrus.Error(err.Error())
+		return fmt.Errorf("get job failed")
+	}
+
+	pw := &jobPodWatcher{
+		cluster: cl,
+		jobName: jobName,
+		pods:    map[string]*corev1.Pod{},
+	}
+
+	// 获取pod以便获取日志
+	if err := pw.refresh(); err != nil {
+		logrus.Error(err.Error())
+		return fmt.Errorf("get job failed")
+	}
+
+	streams := newPodStreams(pw.cluster, sender, opt)
+	defer streams.stop()
+
+	result := func(err error) error {
+		if err == errStreamClosed {
+			return nil
+		}
+
+		return err
+	}
+
+	for {
+		pw.streamPods(streams, opt)
+
+		if !opt.Follow {
+			return result(streams.wait())
+		}
+
+		if err := streams.failed(); err != nil {
+			return result(err)
+		}
+
+		job, err := getJob(jobName)
+		if err != nil {
+			if isNotFound(err) {
+				return nil
+			}
+
+			logrus.Error(err.Error())
+			return fmt.Errorf("get job failed")
+		}
+
+		if isTerminalStatus(jobStatus(job)) {
+			// the pods which are still pending won't print any logs after the job finished
+			return result(streams.wait())
+		}
+
+		jobs.waitChange(watchJobInterval)
+
+		if err := pw.refresh(); err != nil {
+			logrus.Error(err.Error())
+			return fmt.Errorf("watch job failed")
+		}
+	}
+}
+
+func streamPodLogs(ctx context.Context, sender logSender, cl *cluster, pod string, opt *logStreamOption) error {
+	req := cl.clientset.CoreV1().Pods(cl.Namespace).GetLogs(pod, opt.podLogOptions())
+	podLogs, err := req.Stream(ctx)
+	if err != nil {
+		logrus.Error(err.Error())
+		err = fmt.Errorf("get job logs failed")
+		return err
+	}
+	defer podLogs.Close()
+
+	// 按行读取日志内容
+	r := bufio.NewReader(podLogs)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			if err := sender.send(line); err != nil {
+				logrus.Warningf("write stream end: %s", err.Error())
+				return errStreamClosed
+			}
+		}
+
+		if err != nil {
+			logrus.Warningf("read pod logs end: %s", err.Error())
+			return nil
+		}
+	}
+}
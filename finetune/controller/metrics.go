@@ -0,0 +1,344 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	commonctl "github.com/opensourceways/foundation-model-server/common/controller"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	metricStep         = "step"
+	metricEpoch        = "epoch"
+	metricLoss         = "loss"
+	metricLearningRate = "learning_rate"
+	metricThroughput   = "throughput"
+	metricETA          = "eta"
+)
+
+var (
+	metrics     metricStore
+	metricsHub  = newMetricHub()
+	metricParse *metricParser
+
+	defaultMetricPatterns = map[string]string{
+		metricStep:         `\b(?:global_)?step\b['"]?\s*[:=]\s*([0-9]+)`,
+		metricEpoch:        `\bepoch\b['"]?\s*[:=]\s*([-+0-9.eE]+)`,
+		metricLoss:         `\bloss\b['"]?\s*[:=]\s*([-+0-9.eE]+)`,
+		metricLearningRate: `\b(?:learning_rate|lr)\b['"]?\s*[:=]\s*([-+0-9.eE]+)`,
+		metricThroughput:   `\b(?:train_samples_per_second|samples_per_second|throughput)\b['"]?\s*[:=]\s*([-+0-9.eE]+)`,
+		metricETA:          `\beta\b['"]?\s*[:=]?\s*['"]?([0-9][0-9:dhms. ]*[0-9s])`,
+	}
+)
+
+// MetricPoint is the training progress at a moment
+type MetricPoint struct {
+	Time         string   `json:"time"`
+	Step         *int64   `json:"step,omitempty"`
+	Epoch        *float64 `json:"epoch,omitempty"`
+	Loss         *float64 `json:"loss,omitempty"`
+	LearningRate *float64 `json:"learning_rate,omitempty"`
+	Throughput   *float64 `json:"throughput,omitempty"`
+	ETA          string   `json:"eta,omitempty"`
+}
+
+func (p *MetricPoint) isEmpty() bool {
+	return p.Step == nil && p.Loss == nil
+}
+
+func (p *MetricPoint) set(name, v string) {
+	if name == metricETA {
+		p.ETA = strings.TrimSpace(v)
+
+		return
+	}
+
+	if name == metricStep {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			p.Step = &n
+		}
+
+		return
+	}
+
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return
+	}
+
+	switch name {
+	case metricEpoch:
+		p.Epoch = &n
+	case metricLoss:
+		p.Loss = &n
+	case metricLearningRate:
+		p.LearningRate = &n
+	case metricThroughput:
+		p.Throughput = &n
+	}
+}
+
+// metricStore saves the training metrics of jobs as time series
+type metricStore interface {
+	Append(jobName string, p *MetricPoint) error
+	List(jobName string) ([]MetricPoint, error)
+	Delete(jobName string) error
+}
+
+// MetricsConfig
+type MetricsConfig struct {
+	Dir string `json:"dir"`
+	// JSONPrefix is the prefix of lines which are metrics of JSON, the lines are parsed by Patterns if it is empty
+	JSONPrefix string `json:"json_prefix"`
+	// Patterns are regular expressions with one capturing group of each metric
+	Patterns map[string]string `json:"patterns"`
+}
+
+func (cfg *MetricsConfig) setDefault() {
+	if cfg.Dir == "" {
+		cfg.Dir = "/data/disk1/metrics"
+	}
+
+	if len(cfg.Patterns) == 0 {
+		cfg.Patterns = defaultMetricPatterns
+	}
+}
+
+func (cfg *MetricsConfig) validate() error {
+	_, err := newMetricParser(cfg)
+
+	return err
+}
+
+type metricPattern struct {
+	name string
+	re   *regexp.Regexp
+}
+
+type metricParser struct {
+	jsonPrefix []byte
+	patterns   []metricPattern
+}
+
+func newMetricParser(cfg *MetricsConfig) (*metricParser, error) {
+	p := &metricParser{jsonPrefix: []byte(cfg.JSONPrefix)}
+
+	for name, expr := range cfg.Patterns {
+		switch name {
+		case metricStep, metricEpoch, metricLoss, metricLearningRate, metricThroughput, metricETA:
+		default:
+			return nil, fmt.Errorf("unknown metric: %s", name)
+		}
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern of metric %s, err:%s", name, err.Error())
+		}
+
+		if re.NumSubexp() != 1 {
+			return nil, fmt.Errorf("pattern of metric %s must have one capturing group", name)
+		}
+
+		p.patterns = append(p.patterns, metricPattern{name: name, re: re})
+	}
+
+	return p, nil
+}
+
+// parse returns the metric point in the line printed at t, it is nil if there is none
+func (p *metricParser) parse(line []byte, t time.Time) *MetricPoint {
+	var r *MetricPoint
+	if len(p.jsonPrefix) > 0 {
+		r = p.parseJSON(line)
+	} else {
+		r = p.parseText(line)
+	}
+
+	if r == nil || r.isEmpty() {
+		return nil
+	}
+
+	r.Time = t.Format(time.RFC3339)
+
+	return r
+}
+
+func (p *metricParser) parseJSON(line []byte) *MetricPoint {
+	i := bytes.Index(line, p.jsonPrefix)
+	if i < 0 {
+		return nil
+	}
+
+	v := map[string]interface{}{}
+	if err := json.Unmarshal(bytes.TrimSpace(line[i+len(p.jsonPrefix):]), &v); err != nil {
+		return nil
+	}
+
+	r := new(MetricPoint)
+	for _, name := range []string{
+		metricStep, metricEpoch, metricLoss, metricLearningRate, metricThroughput, metricETA,
+	} {
+		if item, ok := v[name]; ok {
+			r.set(name, fmt.Sprint(item))
+		}
+	}
+
+	return r
+}
+
+func (p *metricParser) parseText(line []byte) *MetricPoint {
+	r := new(MetricPoint)
+	for i := range p.patterns {
+		if m := p.patterns[i].re.FindSubmatch(line); m != nil {
+			r.set(p.patterns[i].name, string(m[1]))
+		}
+	}
+
+	return r
+}
+
+// handleMetricLine parses and saves the metric in a line of job logs printed at t
+func handleMetricLine(jobName string, line []byte, t time.Time) {
+	p := metricParse.parse(line, t)
+	if p == nil {
+		return
+	}
+
+	if err := metrics.Append(jobName, p); err != nil {
+		logrus.Errorf("save metric of job %s failed, err:%s", jobName, err.Error())
+	}
+
+	metricsHub.publish(jobName, p)
+}
+
+// metricHub broadcasts the new metric points to the watchers of jobs
+type metricHub struct {
+	mutex sync.Mutex
+	subs  map[string]map[chan MetricPoint]struct{}
+}
+
+func newMetricHub() *metricHub {
+	return &metricHub{subs: map[string]map[chan MetricPoint]struct{}{}}
+}
+
+func (h *metricHub) subscribe(jobName string) chan MetricPoint {
+	ch := make(chan MetricPoint, 100)
+
+	h.mutex.Lock()
+	if h.subs[jobName] == nil {
+		h.subs[jobName] = map[chan MetricPoint]struct{}{}
+	}
+	h.subs[jobName][ch] = struct{}{}
+	h.mutex.Unlock()
+
+	return ch
+}
+
+func (h *metricHub) unsubscribe(jobName string, ch chan MetricPoint) {
+	h.mutex.Lock()
+	if _, ok := h.subs[jobName][ch]; ok {
+		delete(h.subs[jobName], ch)
+		close(ch)
+	}
+	h.mutex.Unlock()
+}
+
+func (h *metricHub) publish(jobName string, p *MetricPoint) {
+	h.mutex.Lock()
+	for ch := range h.subs[jobName] {
+		select {
+		case ch <- *p:
+		default:
+			// drop the point if the watcher is too slow
+		}
+	}
+	h.mutex.Unlock()
+}
+
+// finish closes the watchers of job when there will be no more points
+func (h *metricHub) finish(jobName string) {
+	h.mutex.Lock()
+	for ch := range h.subs[jobName] {
+		close(ch)
+	}
+	delete(h.subs, jobName)
+	h.mutex.Unlock()
+}
+
+// @Summary		Metrics
+// @Description	get the training metrics of a finetune job
+// @Tags			Finetune
+// @Param			jobname	path	string	true	"finetune id"
+// @Success		200	{object}		[]MetricPoint
+// @Failure		500	system_error	system	error
+// @Router			/v1/job/{jobname}/metrics [get]
+func getJobMetrics(c *gin.Context) {
+	v, err := metrics.List(c.Param("jobname"))
+	if err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, v)
+}
+
+// @Summary		get a websocket to watch the training metrics
+// @Description	watch the training metrics of a finetune job
+// @Tags			Finetune
+// @Param			jobname	path	string	true	"finetune id"
+// @Success		200	{object}		MetricPoint
+// @Failure		500	system_error	system	error
+// @Router			/v1/job/{jobname}/metrics/watch [get]
+func watchJobMetrics(c *gin.Context) {
+	jobName := c.Param("jobname")
+
+	// subscribe before reading the history so that no point is missed
+	ch := metricsHub.subscribe(jobName)
+	defer metricsHub.unsubscribe(jobName, ch)
+
+	history, err := metrics.List(jobName)
+	if err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	ws, err := newUpgrader().Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		logrus.Error(err.Error())
+		return
+	}
+	defer ws.Close()
+
+	// the sender guards the writes of the pings and the points
+	sender := newWSLogSender(ws)
+	defer sender.close(finalJobStatus(jobName), nil)
+
+	for i := range history {
+		if err := sender.writeJSON(&history[i]); err != nil {
+			logrus.Warningf("write socket end: %s", err.Error())
+			return
+		}
+	}
+
+	if !collectors.isRunning(jobName) {
+		return
+	}
+
+	for p := range ch {
+		if err := sender.writeJSON(&p); err != nil {
+			logrus.Warningf("write socket end: %s", err.Error())
+			return
+		}
+	}
+}
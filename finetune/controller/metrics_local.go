@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/opensourceways/foundation-model-server/allerror"
+)
+
+// localMetricStore saves the metric points of every job as a JSON lines file
+type localMetricStore struct {
+	dir   string
+	mutex sync.Mutex
+}
+
+func newLocalMetricStore(dir string) (*localMetricStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &localMetricStore{dir: dir}, nil
+}
+
+func (s *localMetricStore) file(jobName string) (string, error) {
+	if _, err := uuid.Parse(jobName); err != nil {
+		return "", allerror.New(allerror.ErrorBadRequestParam, fmt.Sprintf("invalid job: %s", jobName))
+	}
+
+	return filepath.Join(s.dir, jobName+".jsonl"), nil
+}
+
+func (s *localMetricStore) Append(jobName string, p *MetricPoint) error {
+	path, err := s.file(jobName)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	return f.Close()
+}
+
+func (s *localMetricStore) List(jobName string) ([]MetricPoint, error) {
+	path, err := s.file(jobName)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	r := []MetricPoint{}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return r, nil
+		}
+
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var p MetricPoint
+		if err := json.Unmarshal(scanner.Bytes(), &p); err != nil {
+			continue
+		}
+
+		r = append(r, p)
+	}
+
+	return r, scanner.Err()
+}
+
+func (s *localMetricStore) Delete(jobName string) error {
+	path, err := s.file(jobName)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
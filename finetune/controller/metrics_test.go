@@ -0,0 +1,97 @@
+package controller
+
+import "testing"
+
+func TestMetricParser(t *testing.T) {
+	text, err := newMetricParser(&MetricsConfig{Patterns: defaultMetricPatterns})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jsonParser, err := newMetricParser(&MetricsConfig{JSONPrefix: "METRICS "})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	int64p := func(n int64) *int64 { return &n }
+	float64p := func(n float64) *float64 { return &n }
+
+	cases := []struct {
+		name   string
+		parser *metricParser
+		line   string
+		want   *MetricPoint
+	}{
+		{
+			name:   "text",
+			parser: text,
+			line:   "step: 10, epoch=0.5, loss=1.25, lr: 1e-4, eta 0:01:02",
+			want: &MetricPoint{
+				Step: int64p(10), Epoch: float64p(0.5), Loss: float64p(1.25),
+				LearningRate: float64p(1e-4), ETA: "0:01:02",
+			},
+		},
+		{
+			name:   "dict of trainer",
+			parser: text,
+			line:   "{'loss': 0.75, 'learning_rate': 2e-05, 'epoch': 1.0}",
+			want:   &MetricPoint{Epoch: float64p(1), Loss: float64p(0.75), LearningRate: float64p(2e-5)},
+		},
+		{
+			name:   "no step or loss",
+			parser: text,
+			line:   "epoch=1",
+		},
+		{
+			name:   "json",
+			parser: jsonParser,
+			line:   `2024 METRICS {"step": 3, "loss": 0.5, "throughput": 12.5}`,
+			want:   &MetricPoint{Step: int64p(3), Loss: float64p(0.5), Throughput: float64p(12.5)},
+		},
+		{
+			name:   "json without prefix",
+			parser: jsonParser,
+			line:   `{"step": 3, "loss": 0.5}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// the lines are prefixed with the timestamp of kubelet
+			printed, content, ok := splitTimestamp([]byte("2024-01-02T03:04:05.123456789Z " + tc.line))
+			if !ok {
+				t.Fatal("invalid timestamp")
+			}
+
+			got := tc.parser.parse(content, printed)
+			if tc.want == nil {
+				if got != nil {
+					t.Errorf("got %+v, want nil", got)
+				}
+
+				return
+			}
+
+			if got == nil {
+				t.Fatal("got nil")
+			}
+
+			if got.Time != "2024-01-02T03:04:05Z" {
+				t.Errorf("time = %q, want the time when it is printed", got.Time)
+			}
+			got.Time = ""
+
+			if !equalMetricPoint(got, tc.want) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func equalMetricPoint(a, b *MetricPoint) bool {
+	eqInt := func(x, y *int64) bool { return (x == nil && y == nil) || (x != nil && y != nil && *x == *y) }
+	eqFloat := func(x, y *float64) bool { return (x == nil && y == nil) || (x != nil && y != nil && *x == *y) }
+
+	return eqInt(a.Step, b.Step) && eqFloat(a.Epoch, b.Epoch) && eqFloat(a.Loss, b.Loss) &&
+		eqFloat(a.LearningRate, b.LearningRate) && eqFloat(a.Throughput, b.Throughput) && a.ETA == b.ETA
+}
@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opensourceways/foundation-model-server/allerror"
+)
+
+var (
+	models    map[string]*BaseModel
+	modelList []BaseModel
+)
+
+// BaseModel is a model which can be finetuned
+type BaseModel struct {
+	Name string `json:"name"  required:"true"`
+	// Path is relative to the model volume, it is the name of model by default
+	Path string `json:"path"`
+	Size string `json:"size"`
+	// Templates are the names of templates which support this model, all templates are supported if empty
+	Templates []string `json:"templates"`
+	// Resources overrides the resources of template if set
+	Resources TemplateResources `json:"resources"`
+}
+
+func (m *BaseModel) setDefault() {
+	if m.Path == "" {
+		m.Path = m.Name
+	}
+}
+
+func (m *BaseModel) validate(templates map[string]bool) error {
+	if m.Name == "" {
+		return errors.New("missing name of finetune model")
+	}
+
+	if _, err := subPath(m.Path); err != nil {
+		return fmt.Errorf("path of finetune model %s must be relative to the model volume", m.Name)
+	}
+
+	for _, t := range m.Templates {
+		if !templates[t] {
+			return fmt.Errorf("finetune model %s: unknown template %s", m.Name, t)
+		}
+	}
+
+	return m.Resources.validate()
+}
+
+func (m *BaseModel) supportTemplate(name string) bool {
+	if len(m.Templates) == 0 {
+		return true
+	}
+
+	for _, t := range m.Templates {
+		if t == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resources returns the resources of template overridden by the ones of model
+func (m *BaseModel) resources(tpl *JobTemplate) TemplateResources {
+	r := tpl.Resources
+
+	if m.Resources.NPU > 0 {
+		r.NPU = m.Resources.NPU
+	}
+
+	if m.Resources.NPUResource != "" {
+		r.NPUResource = m.Resources.NPUResource
+	}
+
+	if m.Resources.CPU != "" {
+		r.CPU = m.Resources.CPU
+	}
+
+	if m.Resources.Memory != "" {
+		r.Memory = m.Resources.Memory
+	}
+
+	if m.Resources.Nodes > 0 {
+		r.Nodes = m.Resources.Nodes
+	}
+
+	return r
+}
+
+func initModels(cfg *Config) {
+	modelList = cfg.Models
+
+	models = make(map[string]*BaseModel, len(cfg.Models))
+	for i := range cfg.Models {
+		m := &cfg.Models[i]
+		models[m.Name] = m
+	}
+}
+
+// getModel returns the model which can be finetuned by the template
+func getModel(name string, tpl *JobTemplate) (*BaseModel, error) {
+	m, ok := models[name]
+	if !ok {
+		return nil, allerror.New(allerror.ErrorBadRequestParam, fmt.Sprintf("unknown model: %s", name))
+	}
+
+	if !m.supportTemplate(tpl.Name) || (tpl.Model != "" && tpl.Model != name) {
+		return nil, allerror.New(
+			allerror.ErrorBadRequestParam,
+			fmt.Sprintf("model %s can't be finetuned by template %s", name, tpl.Name),
+		)
+	}
+
+	return m, nil
+}
+
+// @Summary		List
+// @Description	list models which can be finetuned
+// @Tags			Finetune
+// @Success		200	{object}		[]BaseModel
+// @Failure		500	system_error	system	error
+// @Router			/v1/finetune/models [get]
+func listModels(c *gin.Context) {
+	c.JSON(http.StatusOK, modelList)
+}
@@ -0,0 +1,723 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	annotationQueued   = "finetune/queued"
+	annotationPriority = "finetune/priority"
+	statusQueued       = "Queued"
+)
+
+var admission *admissionQueue
+
+// usageStore saves the NPUs used by the finished jobs, they are counted in the quota
+// of users after the jobs are deleted
+type usageStore interface {
+	Save(r *usageRecord) error
+	Delete(jobName string) error
+	List() ([]usageRecord, error)
+}
+
+// QueueConfig
+type QueueConfig struct {
+	// Dir is where the NPUs used by the finished jobs are saved
+	Dir string `json:"dir"`
+	// Interval is the seconds between two rounds of admitting the queued jobs
+	Interval int `json:"interval"`
+	// MaxPriority is the max priority of job, the job of higher priority is admitted first
+	MaxPriority int `json:"max_priority"`
+	// QuotaWindow is the hours in which the NPU hours of a user are counted
+	QuotaWindow int `json:"quota_window"`
+	// Default is the quota of every user, 0 means unlimited
+	Default UserQuota `json:"default"`
+	// Users overrides the quota of the specified users
+	Users map[string]UserQuota `json:"users"`
+}
+
+// UserQuota
+type UserQuota struct {
+	MaxRunningJobs int     `json:"max_running_jobs"`
+	MaxNPUHours    float64 `json:"max_npu_hours"`
+}
+
+func (cfg *QueueConfig) setDefault() {
+	if cfg.Dir == "" {
+		cfg.Dir = "/data/disk1/queue"
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10
+	}
+
+	if cfg.MaxPriority <= 0 {
+		cfg.MaxPriority = 10
+	}
+
+	if cfg.QuotaWindow <= 0 {
+		cfg.QuotaWindow = 30 * 24
+	}
+}
+
+func (cfg *QueueConfig) validate() error {
+	if cfg.Default.MaxRunningJobs < 0 || cfg.Default.MaxNPUHours < 0 {
+		return errors.New("invalid quota of finetune queue")
+	}
+
+	for user, q := range cfg.Users {
+		if q.MaxRunningJobs < 0 || q.MaxNPUHours < 0 {
+			return fmt.Errorf("invalid quota of user %s", user)
+		}
+	}
+
+	return nil
+}
+
+func (cfg *QueueConfig) quota(user string) UserQuota {
+	if q, ok := cfg.Users[user]; ok {
+		return q
+	}
+
+	return cfg.Default
+}
+
+func isQueued(job *batchv1.Job) bool {
+	return (job.Annotations[annotationQueued] != "" || waitingForKueue(job)) && !isCancelled(job)
+}
+
+func jobPriority(job *batchv1.Job) int {
+	n, _ := strconv.Atoi(job.Annotations[annotationPriority])
+
+	return n
+}
+
+// jobNPUs returns the NPUs requested by the pods of job
+func jobNPUs(job *batchv1.Job, npuResources map[corev1.ResourceName]bool) corev1.ResourceList {
+	r := corev1.ResourceList{}
+
+	for i := range job.Spec.Template.Spec.Containers {
+		for name, q := range job.Spec.Template.Spec.Containers[i].Resources.Limits {
+			if npuResources[name] {
+				addQuantity(r, name, q.Value())
+			}
+		}
+	}
+
+	if p := job.Spec.Parallelism; p != nil && *p > 1 {
+		for name, q := range r {
+			r[name] = *resource.NewQuantity(q.Value()*int64(*p), resource.DecimalSI)
+		}
+	}
+
+	return r
+}
+
+func addQuantity(r corev1.ResourceList, name corev1.ResourceName, n int64) {
+	q := r[name]
+	r[name] = *resource.NewQuantity(q.Value()+n, resource.DecimalSI)
+}
+
+// admissionQueue submits the queued jobs to kubernetes by the order of priority and submit time
+// when there are enough NPUs and the quota of the user is not exceeded.
+type admissionQueue struct {
+	cfg          QueueConfig
+	npuResources map[corev1.ResourceName]bool
+	trigger      chan struct{}
+	// admitted is the jobs admitted which are not synced to the cache yet
+	admitted map[string]bool
+
+	mutex     sync.Mutex
+	positions map[string]int
+	reasons   map[string]string
+
+	// finished is the usages of the finished jobs in the store, they are kept after the
+	// jobs are deleted
+	store         usageStore
+	finishedMutex sync.Mutex
+	finished      map[string]usageRecord
+}
+
+func newAdmissionQueue(cfg *Config, store usageStore) (*admissionQueue, error) {
+	records, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	q := &admissionQueue{
+		cfg:          cfg.Queue,
+		npuResources: map[corev1.ResourceName]bool{},
+		trigger:      make(chan struct{}, 1),
+		admitted:     map[string]bool{},
+		positions:    map[string]int{},
+		reasons:      map[string]string{},
+		store:        store,
+		finished:     make(map[string]usageRecord, len(records)),
+	}
+
+	for _, r := range records {
+		q.finished[r.JobName] = r
+	}
+
+	for i := range cfg.Templates {
+		q.npuResources[corev1.ResourceName(cfg.Templates[i].Resources.NPUResource)] = true
+	}
+
+	for i := range cfg.Models {
+		if v := cfg.Models[i].Resources.NPUResource; v != "" {
+			q.npuResources[corev1.ResourceName(v)] = true
+		}
+	}
+
+	for i := range cfg.Eval.Suites {
+		if v := cfg.Eval.Suites[i].Resources.NPUResource; v != "" {
+			q.npuResources[corev1.ResourceName(v)] = true
+		}
+	}
+
+	return q, nil
+}
+
+// notify starts a round of admitting soon, it is called after a job is queued
+func (q *admissionQueue) notify() {
+	select {
+	case q.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (q *admissionQueue) run() {
+	interval := time.Duration(q.cfg.Interval) * time.Second
+
+	for {
+		if err := q.admit(); err != nil {
+			logrus.Errorf("admit finetune jobs failed, err:%s", err.Error())
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-q.trigger:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// position returns the position of job in the queue, 0 if it is not queued
+func (q *admissionQueue) position(jobName string) int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.positions[jobName]
+}
+
+// reason returns why the queued job is not admitted
+func (q *admissionQueue) reason(jobName string) string {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.reasons[jobName]
+}
+
+// userUsage is the running jobs and the NPU hours used by a user
+type userUsage struct {
+	running  int
+	npuHours float64
+}
+
+// usageRecord is the NPUs used by a job from its start to its end
+type usageRecord struct {
+	JobName string    `json:"job_name"`
+	User    string    `json:"user"`
+	NPUs    int64     `json:"npus"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+}
+
+// npuHours returns the NPU hours used after since
+func (r *usageRecord) npuHours(since time.Time) float64 {
+	start := r.Start
+	if start.Before(since) {
+		start = since
+	}
+
+	if !r.End.After(start) {
+		return 0
+	}
+
+	return float64(r.NPUs) * r.End.Sub(start).Hours()
+}
+
+// jobUsage returns the NPUs used by the job until it finished or now, false if it is not started
+func (q *admissionQueue) jobUsage(job *batchv1.Job, now time.Time) (usageRecord, bool) {
+	if job.Status.StartTime == nil {
+		return usageRecord{}, false
+	}
+
+	end := now
+	switch {
+	case job.Status.CompletionTime != nil:
+		end = job.Status.CompletionTime.Time
+	case isCancelled(job):
+		if t, err := time.Parse(time.RFC3339, job.Annotations[annotationCancelled]); err == nil {
+			end = t
+		}
+	case jobStatus(job) == statusFailed:
+		if n := len(job.Status.Conditions); n > 0 {
+			end = job.Status.Conditions[n-1].LastTransitionTime.Time
+		}
+	}
+
+	var npus int64
+	for _, v := range jobNPUs(job, q.npuResources) {
+		npus += v.Value()
+	}
+
+	return usageRecord{
+		JobName: job.Name,
+		User:    job.Labels["create_by"],
+		NPUs:    npus,
+		Start:   job.Status.StartTime.Time,
+		End:     end,
+	}, true
+}
+
+func (q *admissionQueue) npuHours(job *batchv1.Job, since, now time.Time) float64 {
+	r, ok := q.jobUsage(job, now)
+	if !ok {
+		return 0
+	}
+
+	return r.npuHours(since)
+}
+
+// windowStart returns the start of the quota window
+func (q *admissionQueue) windowStart(now time.Time) time.Time {
+	return now.Add(-time.Duration(q.cfg.QuotaWindow) * time.Hour)
+}
+
+// recordUsage saves the NPUs used by the job which is finished or deleted, it returns
+// nil if the job is not started or it ended before the quota window.
+func (q *admissionQueue) recordUsage(job *batchv1.Job) (*usageRecord, error) {
+	q.finishedMutex.Lock()
+	defer q.finishedMutex.Unlock()
+
+	if r, ok := q.finished[job.Name]; ok {
+		return &r, nil
+	}
+
+	now := time.Now()
+	r, ok := q.jobUsage(job, now)
+	if !ok || !r.End.After(q.windowStart(now)) {
+		return nil, nil
+	}
+
+	if err := q.store.Save(&r); err != nil {
+		return nil, err
+	}
+	q.finished[job.Name] = r
+
+	return &r, nil
+}
+
+// finishedUsages returns the usages of finished jobs which ended after since,
+// the older ones are removed from the store.
+func (q *admissionQueue) finishedUsages(since time.Time) map[string]usageRecord {
+	q.finishedMutex.Lock()
+	defer q.finishedMutex.Unlock()
+
+	r := make(map[string]usageRecord, len(q.finished))
+	for name, v := range q.finished {
+		if v.End.After(since) {
+			r[name] = v
+
+			continue
+		}
+
+		if err := q.store.Delete(name); err != nil {
+			logrus.Errorf("delete usage of job %s failed, err:%s", name, err.Error())
+
+			continue
+		}
+		delete(q.finished, name)
+	}
+
+	return r
+}
+
+// usages counts the running jobs in the cache and the NPU hours of the jobs in the quota
+// window, the NPU hours of the finished jobs are read from the store because they are
+// still counted after the jobs are deleted.
+func (q *admissionQueue) usages(items []*batchv1.Job) map[string]*userUsage {
+	now := time.Now()
+	since := q.windowStart(now)
+
+	r := map[string]*userUsage{}
+	get := func(user string) *userUsage {
+		u, ok := r[user]
+		if !ok {
+			u = &userUsage{}
+			r[user] = u
+		}
+
+		return u
+	}
+
+	finished := q.finishedUsages(since)
+	for _, job := range items {
+		if isQueued(job) {
+			continue
+		}
+
+		u := get(job.Labels["create_by"])
+
+		terminal := isTerminalStatus(jobStatus(job))
+		if !terminal {
+			u.running++
+		}
+
+		// the job is recorded when it is deleted before it finishes
+		if _, ok := finished[job.Name]; ok {
+			continue
+		}
+
+		if terminal {
+			v, err := q.recordUsage(job)
+			if err == nil {
+				if v != nil {
+					finished[job.Name] = *v
+				}
+
+				continue
+			}
+
+			logrus.Errorf("save usage of job %s failed, err:%s", job.Name, err.Error())
+		}
+
+		u.npuHours += q.npuHours(job, since, now)
+	}
+
+	for i := range finished {
+		v := finished[i]
+		get(v.User).npuHours += v.npuHours(since)
+	}
+
+	return r
+}
+
+// quotaExceeded checks the quota of user, it returns the reason if exceeded
+func (q *admissionQueue) quotaExceeded(user string, u *userUsage) string {
+	quota := q.cfg.quota(user)
+
+	if quota.MaxRunningJobs > 0 && u.running >= quota.MaxRunningJobs {
+		return fmt.Sprintf("the quota of %d running jobs is exceeded", quota.MaxRunningJobs)
+	}
+
+	if quota.MaxNPUHours > 0 && u.npuHours >= quota.MaxNPUHours {
+		return fmt.Sprintf(
+			"the quota of %g NPU hours in %d hours is exceeded", quota.MaxNPUHours, q.cfg.QuotaWindow,
+		)
+	}
+
+	return ""
+}
+
+// freeNPUs returns the NPUs which the finetune jobs can use in the cluster. They are the capacity
+// of cluster which is not used by the pods in the namespace if it is set, otherwise the NPUs which
+// are allocatable and not requested on the nodes of finetune jobs.
+func (q *admissionQueue) freeNPUs(cl *cluster) (corev1.ResourceList, error) {
+	if cl.Capacity > 0 {
+		return q.capacityNPUs(cl)
+	}
+
+	l, err := cl.nodeListers()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := l.nodeLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	free := corev1.ResourceList{}
+	names := map[string]bool{}
+	for _, node := range nodes {
+		if node.Spec.Unschedulable {
+			continue
+		}
+
+		names[node.Name] = true
+		for name, v := range node.Status.Allocatable {
+			if q.npuResources[name] {
+				addQuantity(free, name, v.Value())
+			}
+		}
+	}
+
+	pods, err := l.podLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pod := range pods {
+		// the pods of finetune jobs which are not scheduled yet will take the NPUs too
+		if !names[pod.Spec.NodeName] && (pod.Spec.NodeName != "" || pod.Namespace != cl.Namespace) {
+			continue
+		}
+
+		for name, v := range podNPUs(pod, q.npuResources) {
+			addQuantity(free, name, -v.Value())
+		}
+	}
+
+	return free, nil
+}
+
+// capacityNPUs returns the capacity of cluster which is not used by the pods in the namespace,
+// they are read from the cache of jobs and the nodes are not read.
+func (q *admissionQueue) capacityNPUs(cl *cluster) (corev1.ResourceList, error) {
+	pods, err := jobs.listClusterPods(cl)
+	if err != nil {
+		return nil, err
+	}
+
+	var used int64
+	for _, pod := range pods {
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+
+		for _, v := range podNPUs(pod, q.npuResources) {
+			used += v.Value()
+		}
+	}
+
+	free := corev1.ResourceList{}
+	for name := range q.npuResources {
+		free[name] = *resource.NewQuantity(int64(cl.Capacity)-used, resource.DecimalSI)
+	}
+
+	return free, nil
+}
+
+// podNPUs returns the NPUs requested by the containers of pod
+func podNPUs(pod *corev1.Pod, npuResources map[corev1.ResourceName]bool) corev1.ResourceList {
+	r := corev1.ResourceList{}
+	for i := range pod.Spec.Containers {
+		for name, v := range pod.Spec.Containers[i].Resources.Limits {
+			if npuResources[name] {
+				addQuantity(r, name, v.Value())
+			}
+		}
+	}
+
+	return r
+}
+
+func fits(need, free corev1.ResourceList) bool {
+	for name, v := range need {
+		f := free[name]
+		if v.Value() > f.Value() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// admit runs a round of admitting the queued jobs
+func (q *admissionQueue) admit() error {
+	items, err := jobs.listQueuedJobs()
+	if err != nil {
+		return err
+	}
+
+	queued := make([]*batchv1.Job, 0, len(items))
+	pending := map[*cluster]corev1.ResourceList{}
+	admitted := map[string]bool{}
+	for _, job := range items {
+		// the job admitted by the queue may be waiting for the backend
+		if job.Annotations[annotationQueued] == "" || isCancelled(job) {
+			continue
+		}
+
+		if q.admitted[job.Name] {
+			admitted[job.Name] = true
+
+			cl, err := clusterOf(job)
+			if err != nil {
+				logrus.Errorf("count NPUs of job %s failed, err:%s", job.Name, err.Error())
+
+				continue
+			}
+
+			if pending[cl] == nil {
+				pending[cl] = corev1.ResourceList{}
+			}
+			for name, v := range jobNPUs(job, q.npuResources) {
+				addQuantity(pending[cl], name, v.Value())
+			}
+
+			continue
+		}
+
+		queued = append(queued, job)
+	}
+	q.admitted = admitted
+
+	// the jobs are sorted by the submit time already
+	sort.SliceStable(queued, func(i, j int) bool {
+		return jobPriority(queued[i]) > jobPriority(queued[j])
+	})
+
+	positions := make(map[string]int, len(queued))
+	reasons := make(map[string]string, len(queued))
+
+	defer func() {
+		q.mutex.Lock()
+		q.positions, q.reasons = positions, reasons
+		q.mutex.Unlock()
+	}()
+
+	if len(queued) == 0 {
+		return nil
+	}
+
+	usages := q.usages(items)
+	for _, job := range items {
+		if admitted[job.Name] {
+			if u, ok := usages[job.Labels["create_by"]]; ok {
+				u.running++
+			} else {
+				usages[job.Labels["create_by"]] = &userUsage{running: 1}
+			}
+		}
+	}
+
+	// the jobs are blocked and the NPUs are counted in every cluster
+	blocked := map[*cluster]string{}
+	free := map[*cluster]corev1.ResourceList{}
+	position := 0
+
+	for _, job := range queued {
+		user := job.Labels["create_by"]
+		u, ok := usages[user]
+		if !ok {
+			u = &userUsage{}
+			usages[user] = u
+		}
+
+		position++
+		positions[job.Name] = position
+
+		if reason := q.quotaExceeded(user, u); reason != "" {
+			reasons[job.Name] = reason
+
+			continue
+		}
+
+		cl, err := clusterOf(job)
+		if err != nil {
+			logrus.Errorf("admit job %s failed, err:%s", job.Name, err.Error())
+			reasons[job.Name] = "unknown cluster"
+
+			continue
+		}
+
+		// the job behind is not admitted before the one which is waiting for NPUs in the same cluster
+		if blocked[cl] != "" {
+			reasons[job.Name] = blocked[cl]
+
+			continue
+		}
+
+		f, ok := free[cl]
+		if !ok {
+			var err error
+			if f, err = q.clusterFree(cl, pending[cl]); err != nil {
+				logrus.Errorf("get free NPUs of cluster %s failed, err:%s", cl.Name, err.Error())
+				reasons[job.Name] = "waiting for free NPUs"
+
+				continue
+			}
+			free[cl] = f
+		}
+
+		need := jobNPUs(job, q.npuResources)
+		if f != nil && !fits(need, f) {
+			blocked[cl] = fmt.Sprintf("waiting for the NPUs of job %s", job.Name)
+			reasons[job.Name] = "waiting for free NPUs"
+
+			continue
+		}
+
+		if err := admitJob(cl, job.Name); err != nil {
+			logrus.Errorf("admit job %s failed, err:%s", job.Name, err.Error())
+			reasons[job.Name] = "admitting failed"
+
+			continue
+		}
+
+		if f != nil {
+			for name, v := range need {
+				addQuantity(f, name, -v.Value())
+			}
+		}
+		u.running++
+		q.admitted[job.Name] = true
+
+		delete(positions, job.Name)
+		position--
+	}
+
+	return nil
+}
+
+// clusterFree returns the NPUs of cluster for the queued jobs, it is nil if the backend
+// admits the pods by the capacity itself.
+func (q *admissionQueue) clusterFree(cl *cluster, pending corev1.ResourceList) (corev1.ResourceList, error) {
+	if schedulerCfg.schedulesCapacity() {
+		return nil, nil
+	}
+
+	free, err := q.freeNPUs(cl)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, v := range pending {
+		addQuantity(free, name, -v.Value())
+	}
+
+	return free, nil
+}
+
+// admitJob hands the job over to the scheduler backend
+func admitJob(cl *cluster, jobName string) error {
+	patch, err := json.Marshal(schedulerCfg.admitPatch())
+	if err != nil {
+		return err
+	}
+
+	_, err = cl.clientset.BatchV1().Jobs(cl.Namespace).Patch(
+		context.TODO(), jobName, types.MergePatchType, patch, metav1.PatchOptions{},
+	)
+
+	return err
+}
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+	"github.com/opensourceways/foundation-model-server/allerror"
+)
+
+const usageFileSuffix = ".json"
+
+// localUsageStore saves the usage of every finished job as a JSON file
+type localUsageStore struct {
+	dir string
+}
+
+func newLocalUsageStore(dir string) (*localUsageStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &localUsageStore{dir: dir}, nil
+}
+
+func (s *localUsageStore) file(jobName string) (string, error) {
+	if _, err := uuid.Parse(jobName); err != nil {
+		return "", allerror.New(allerror.ErrorBadRequestParam, fmt.Sprintf("invalid job: %s", jobName))
+	}
+
+	return filepath.Join(s.dir, jobName+usageFileSuffix), nil
+}
+
+func (s *localUsageStore) Save(r *usageRecord) error {
+	path, err := s.file(r.JobName)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, func(w *bufio.Writer) error {
+		return json.NewEncoder(w).Encode(r)
+	})
+}
+
+func (s *localUsageStore) Delete(jobName string) error {
+	path, err := s.file(jobName)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *localUsageStore) List() ([]usageRecord, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*"+usageFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	r := make([]usageRecord, 0, len(files))
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		var v usageRecord
+		if err := json.Unmarshal(b, &v); err != nil {
+			return nil, err
+		}
+
+		r = append(r, v)
+	}
+
+	return r, nil
+}
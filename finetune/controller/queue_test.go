@@ -0,0 +1,223 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testNPUResource = "huawei.com/Ascend910"
+
+func queuedJob(name string, npus int64, created time.Time) *batchv1.Job {
+	suspend := true
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "finetune",
+			CreationTimestamp: metav1.NewTime(created),
+			Labels:            map[string]string{"create_by": "alice"},
+			Annotations:       map[string]string{annotationQueued: "true"},
+		},
+		Spec: batchv1.JobSpec{
+			Suspend: &suspend,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name: "finetune",
+						Resources: corev1.ResourceRequirements{
+							Limits: corev1.ResourceList{
+								testNPUResource: *resource.NewQuantity(npus, resource.DecimalSI),
+							},
+						},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// withTestCluster runs the queue on a fake cluster which has the objects
+func withTestCluster(t *testing.T, backend string, capacity int, objects ...runtime.Object) *cluster {
+	oldClusters, oldJobs, oldScheduler := clusters, jobs, schedulerCfg
+	t.Cleanup(func() {
+		clusters, jobs, schedulerCfg = oldClusters, oldJobs, oldScheduler
+	})
+
+	schedulerCfg = SchedulerConfig{Backend: backend}
+	schedulerCfg.setDefault()
+
+	cl := &cluster{
+		ClusterConfig: ClusterConfig{Name: "test", Namespace: "finetune", Capacity: capacity},
+		clientset:     fake.NewSimpleClientset(objects...),
+	}
+	clusters = []*cluster{cl}
+
+	var err error
+	if jobs, err = newJobCache(clusters); err != nil {
+		t.Fatal(err)
+	}
+
+	return cl
+}
+
+func newTestQueue(t *testing.T, dir string, cfg QueueConfig) *admissionQueue {
+	store, err := newLocalUsageStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.setDefault()
+
+	q, err := newAdmissionQueue(&Config{
+		Queue:     cfg,
+		Templates: []JobTemplate{{Resources: TemplateResources{NPUResource: testNPUResource}}},
+	}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return q
+}
+
+func TestAdmit(t *testing.T) {
+	now := time.Now()
+
+	cases := []struct {
+		backend string
+		// admitted is whether each of the jobs is handed over to the backend
+		admitted []bool
+	}{
+		// the third job waits for the NPUs in the capacity of 8
+		{backend: backendDefault, admitted: []bool{true, true, false}},
+		// the backends admit the pods by the capacity themselves
+		{backend: backendVolcano, admitted: []bool{true, true, true}},
+		{backend: backendKueue, admitted: []bool{true, true, true}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.backend, func(t *testing.T) {
+			objects := make([]runtime.Object, len(tc.admitted))
+			for i := range objects {
+				objects[i] = queuedJob(fmt.Sprintf("job-%d", i), 4, now.Add(time.Duration(i)*time.Second))
+			}
+
+			cl := withTestCluster(t, tc.backend, 8, objects...)
+
+			q := newTestQueue(t, t.TempDir(), QueueConfig{})
+
+			if err := q.admit(); err != nil {
+				t.Fatalf("admit failed, err:%s", err.Error())
+			}
+
+			for i, want := range tc.admitted {
+				name := fmt.Sprintf("job-%d", i)
+
+				job, err := cl.clientset.BatchV1().Jobs(cl.Namespace).Get(context.TODO(), name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if got := job.Annotations[annotationQueued] == ""; got != want {
+					t.Errorf("job %s: admitted = %v, want %v", name, got, want)
+				}
+
+				if !want {
+					if q.reason(name) == "" {
+						t.Errorf("job %s: no reason why it is not admitted", name)
+					}
+
+					continue
+				}
+
+				if tc.backend == backendKueue {
+					if job.Labels[labelKueueQueueName] != schedulerCfg.QueueName {
+						t.Errorf("job %s: queue of kueue = %q", name, job.Labels[labelKueueQueueName])
+					}
+				} else if job.Spec.Suspend == nil || *job.Spec.Suspend {
+					t.Errorf("job %s is still suspended", name)
+				}
+			}
+		})
+	}
+}
+
+func TestUsagesAfterDelete(t *testing.T) {
+	now := time.Now()
+
+	finished := queuedJob(uuid.New().String(), 4, now.Add(-3*time.Hour))
+	delete(finished.Annotations, annotationQueued)
+	finished.Status = batchv1.JobStatus{
+		StartTime:      &metav1.Time{Time: now.Add(-3 * time.Hour)},
+		CompletionTime: &metav1.Time{Time: now.Add(-time.Hour)},
+		Conditions: []batchv1.JobCondition{{
+			Type:               batchv1.JobComplete,
+			Status:             corev1.ConditionTrue,
+			LastTransitionTime: metav1.Time{Time: now.Add(-time.Hour)},
+		}},
+	}
+
+	cl := withTestCluster(t, backendDefault, 8, finished, queuedJob(uuid.New().String(), 4, now))
+
+	dir := t.TempDir()
+	cfg := QueueConfig{Default: UserQuota{MaxNPUHours: 8}}
+	q := newTestQueue(t, dir, cfg)
+
+	usedHours := func(q *admissionQueue) float64 {
+		items, err := jobs.listQueuedJobs()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if u := q.usages(items)["alice"]; u != nil {
+			return u.npuHours
+		}
+
+		return 0
+	}
+
+	if got := usedHours(q); got < 7.99 || got > 8.01 {
+		t.Fatalf("NPU hours before deletion = %g, want 8", got)
+	}
+
+	err := cl.clientset.BatchV1().Jobs(cl.Namespace).Delete(context.TODO(), finished.Name, metav1.DeleteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = jobs.waitFor(ctx, func() (bool, error) {
+		_, err := jobs.getJob(finished.Name)
+
+		return isNotFound(err), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the usage is read from the store after the job is deleted and the server is restarted
+	for _, q := range []*admissionQueue{q, newTestQueue(t, dir, cfg)} {
+		if got := usedHours(q); got < 7.99 || got > 8.01 {
+			t.Errorf("NPU hours after deletion = %g, want 8", got)
+		}
+
+		if err := q.admit(); err != nil {
+			t.Fatal(err)
+		}
+
+		if items, _ := jobs.listQueuedJobs(); len(items) != 1 || q.reason(items[0].Name) == "" {
+			t.Errorf("the queued job is admitted after the quota is exceeded")
+		}
+	}
+}
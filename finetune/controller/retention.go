@@ -0,0 +1,383 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opensourceways/foundation-model-server/allerror"
+	commonctl "github.com/opensourceways/foundation-model-server/common/controller"
+	"github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	annotationRetentionDays = "finetune/retention-days"
+
+	// keepForever is the retention days of the job which is never deleted by the reaper
+	keepForever = -1
+)
+
+var (
+	retentionCfg RetentionConfig
+	reaper       *jobReaper
+)
+
+// archiveStore saves the records of jobs deleted by the reaper
+type archiveStore interface {
+	Save(r *ArchivedJob) error
+	Get(jobName string) (ArchivedJob, error)
+	List() ([]ArchivedJob, error)
+}
+
+// RetentionConfig is how long the finished jobs are kept. The jobs don't set
+// TTLSecondsAfterFinished, because their logs and records are archived before deleted.
+type RetentionConfig struct {
+	// Dir is where the records of deleted jobs are archived
+	Dir string `json:"dir"`
+	// Interval is the seconds between two rounds of reaping
+	Interval int `json:"interval"`
+	// SucceededDays is the days to keep the succeeded jobs, -1 means forever
+	SucceededDays int `json:"succeeded_days"`
+	// FailedDays is the days to keep the failed and cancelled jobs, -1 means forever
+	FailedDays int `json:"failed_days"`
+}
+
+func (cfg *RetentionConfig) setDefault() {
+	if cfg.Dir == "" {
+		cfg.Dir = "/data/disk1/archive"
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = 600
+	}
+
+	if cfg.SucceededDays == 0 {
+		cfg.SucceededDays = 30
+	}
+
+	if cfg.FailedDays == 0 {
+		cfg.FailedDays = 7
+	}
+}
+
+func (cfg *RetentionConfig) validate() error {
+	if cfg.SucceededDays < keepForever || cfg.FailedDays < keepForever {
+		return fmt.Errorf("invalid retention days, it should be positive or %d", keepForever)
+	}
+
+	return nil
+}
+
+// RetentionRequest is the body of changing the retention of a job
+type RetentionRequest struct {
+	// Days overrides the retention policy, 0 means the policy and -1 means forever
+	Days int `json:"days"`
+}
+
+// ArchivedJob is the record of a job deleted by the reaper, its logs are kept in the log archive
+type ArchivedJob struct {
+	JobInfo
+
+	Events     []JobEvent `json:"events"`
+	FinishedAt string     `json:"finished_at"`
+	ArchivedAt string     `json:"archived_at"`
+	// Owner is the hash of token which created the job, it is not returned
+	Owner string `json:"owner,omitempty"`
+}
+
+func checkRetentionDays(days int) error {
+	if days < keepForever {
+		return allerror.New(
+			allerror.ErrorBadRequestParam,
+			fmt.Sprintf("invalid retention days, it should not be less than %d", keepForever),
+		)
+	}
+
+	return nil
+}
+
+func jobRetentionDays(job *batchv1.Job) int {
+	n, _ := strconv.Atoi(job.Annotations[annotationRetentionDays])
+
+	return n
+}
+
+// retention returns how long the finished job is kept, false if it is kept forever
+func retention(job *batchv1.Job, status string) (time.Duration, bool) {
+	days := jobRetentionDays(job)
+	if days == 0 {
+		days = retentionCfg.FailedDays
+		if status == statusComplete {
+			days = retentionCfg.SucceededDays
+		}
+	}
+
+	if days == keepForever {
+		return 0, false
+	}
+
+	return time.Duration(days) * 24 * time.Hour, true
+}
+
+// finishedAt returns when the job finished, it is the time of the last condition
+// or the time when it was cancelled.
+func finishedAt(job *batchv1.Job) time.Time {
+	if job.Status.CompletionTime != nil {
+		return job.Status.CompletionTime.Time
+	}
+
+	r := job.CreationTimestamp.Time
+	for i := range job.Status.Conditions {
+		if t := job.Status.Conditions[i].LastTransitionTime.Time; t.After(r) {
+			r = t
+		}
+	}
+
+	if t, err := time.Parse(time.RFC3339, job.Annotations[annotationCancelled]); err == nil && t.After(r) {
+		r = t
+	}
+
+	return r
+}
+
+func setRetentionDays(cl *cluster, jobName string, days int) error {
+	var v interface{}
+	if days != 0 {
+		v = strconv.Itoa(days)
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{annotationRetentionDays: v},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = cl.clientset.BatchV1().Jobs(cl.Namespace).Patch(
+		context.TODO(), jobName, types.MergePatchType, patch, metav1.PatchOptions{},
+	)
+
+	return err
+}
+
+// jobReaper archives and deletes the jobs which are kept longer than their retention
+type jobReaper struct {
+	store archiveStore
+	// collecting is the jobs whose logs are being collected before they are deleted
+	collecting map[string]bool
+}
+
+func newJobReaper(store archiveStore) *jobReaper {
+	return &jobReaper{
+		store:      store,
+		collecting: map[string]bool{},
+	}
+}
+
+func (r *jobReaper) run() {
+	interval := time.Duration(retentionCfg.Interval) * time.Second
+
+	for {
+		if err := r.reap(); err != nil {
+			logrus.Errorf("reap finetune jobs failed, err:%s", err.Error())
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+func (r *jobReaper) reap() error {
+	jobList, err := jobs.listJobs()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	for _, job := range jobList {
+		status := jobStatus(job)
+		if !isTerminalStatus(status) || job.Annotations[annotationServedModel] != "" {
+			continue
+		}
+
+		ttl, ok := retention(job, status)
+		if !ok || now.Sub(finishedAt(job)) < ttl {
+			continue
+		}
+
+		// the logs of job finished when the server was down are collected before it is deleted
+		if !logs.Exists(job.Name) && !r.collecting[job.Name] {
+			r.collecting[job.Name] = true
+			collectors.start(job.Name)
+
+			continue
+		}
+
+		if collectors.isRunning(job.Name) {
+			continue
+		}
+
+		if err := r.archive(job, status); err != nil {
+			logrus.Errorf("archive job %s failed, err:%s", job.Name, err.Error())
+
+			continue
+		}
+
+		if err := doDeleteJob(job.Name); err != nil {
+			logrus.Errorf("delete expired job %s failed, err:%s", job.Name, err.Error())
+
+			continue
+		}
+
+		delete(r.collecting, job.Name)
+		logrus.Infof("job %s is deleted after its retention", job.Name)
+	}
+
+	return nil
+}
+
+func (r *jobReaper) archive(job *batchv1.Job, status string) error {
+	info, err := toJobInfo(job)
+	if err != nil {
+		return err
+	}
+
+	pods, err := jobs.listPods(job.Name)
+	if err != nil {
+		return err
+	}
+
+	if status == statusFailed {
+		info.Reason = jobReason(job, pods)
+	}
+
+	cl, err := clusterOf(job)
+	if err != nil {
+		return err
+	}
+
+	events, err := jobEvents(cl, job.Name)
+	if err != nil {
+		return err
+	}
+
+	return r.store.Save(&ArchivedJob{
+		JobInfo:    info,
+		Events:     events,
+		FinishedAt: finishedAt(job).Format(time.RFC3339),
+		ArchivedAt: time.Now().Format(time.RFC3339),
+		Owner:      jobOwnerHash(job),
+	})
+}
+
+// @Summary		Retention
+// @Description	override the retention policy of a finetune, 0 restores the policy and -1 keeps it forever
+// @Tags			Finetune
+// @Param			jobname	path	string				true	"finetune id"
+// @Param			body	body	RetentionRequest	true	"body of changing retention"
+// @Accept			json
+// @Success		200
+// @Failure		500	system_error	system	error
+// @Router			/v1/job/{jobname}/retention [post]
+func setJobRetention(c *gin.Context) {
+	jobName := c.Param("jobname")
+
+	var req RetentionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		commonctl.SendBadRequestBody(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	if err := checkRetentionDays(req.Days); err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	if err := checkJobPerm(jobName, c.GetHeader(headerSecret), "update"); err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	job, err := getJob(jobName)
+	if err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	cl, err := clusterOf(job)
+	if err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	if err := setRetentionDays(cl, jobName, req.Days); err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"msg": fmt.Sprintf("Retention of job %s updated", jobName),
+	})
+}
+
+// @Summary		List
+// @Description	list the finetunes deleted after their retention
+// @Tags			Finetune
+// @Param			username	query	string	false	"creator of job"
+// @Success		200	{object}		[]ArchivedJob
+// @Failure		500	system_error	system	error
+// @Router			/v1/finetune/archived-jobs [get]
+func listArchivedJobs(c *gin.Context) {
+	items, err := reaper.store.List()
+	if err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	username := c.Query("username")
+
+	r := make([]ArchivedJob, 0, len(items))
+	for i := range items {
+		if username == "" || items[i].Username == username {
+			items[i].Owner = ""
+			r = append(r, items[i])
+		}
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+// @Summary		Get
+// @Description	get a finetune deleted after its retention, its logs are read by the archived logs
+// @Tags			Finetune
+// @Param			jobname	path	string	true	"finetune id"
+// @Success		200	{object}		ArchivedJob
+// @Failure		500	system_error	system	error
+// @Router			/v1/finetune/archived-jobs/{jobname} [get]
+func getArchivedJob(c *gin.Context) {
+	v, err := reaper.store.Get(c.Param("jobname"))
+	if err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	v.Owner = ""
+	c.JSON(http.StatusOK, v)
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/opensourceways/foundation-model-server/allerror"
+)
+
+const archiveFileSuffix = ".json"
+
+// localArchiveStore saves the record of every deleted job as a JSON file
+type localArchiveStore struct {
+	dir string
+}
+
+func newLocalArchiveStore(dir string) (*localArchiveStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &localArchiveStore{dir: dir}, nil
+}
+
+func (s *localArchiveStore) file(jobName string) (string, error) {
+	if _, err := uuid.Parse(jobName); err != nil {
+		return "", allerror.New(allerror.ErrorBadRequestParam, fmt.Sprintf("invalid job: %s", jobName))
+	}
+
+	return filepath.Join(s.dir, jobName+archiveFileSuffix), nil
+}
+
+func (s *localArchiveStore) Save(r *ArchivedJob) error {
+	path, err := s.file(r.JobName)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, func(w *bufio.Writer) error {
+		return json.NewEncoder(w).Encode(r)
+	})
+}
+
+func (s *localArchiveStore) Get(jobName string) (r ArchivedJob, err error) {
+	path, err := s.file(jobName)
+	if err != nil {
+		return
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = allerror.NewNotFound(fmt.Sprintf("archived job %s not found", jobName))
+		}
+
+		return
+	}
+
+	err = json.Unmarshal(b, &r)
+
+	return
+}
+
+func (s *localArchiveStore) List() ([]ArchivedJob, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*"+archiveFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	r := make([]ArchivedJob, 0, len(files))
+	for _, f := range files {
+		v, err := s.Get(strings.TrimSuffix(filepath.Base(f), archiveFileSuffix))
+		if err != nil {
+			return nil, err
+		}
+
+		r = append(r, v)
+	}
+
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].ArchivedAt > r[j].ArchivedAt
+	})
+
+	return r, nil
+}
@@ -0,0 +1,221 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opensourceways/foundation-model-server/allerror"
+	commonctl "github.com/opensourceways/foundation-model-server/common/controller"
+	"github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+const (
+	annotationRetryOf    = "finetune/retry-of"
+	annotationAttempt    = "finetune/attempt"
+	annotationResumeFrom = "finetune/resume-from"
+
+	envResumeFrom = "RESUME_FROM"
+)
+
+// RetryRequest is the body of retrying a job
+type RetryRequest struct {
+	// Resume passes the checkpoint of the job to the new attempt
+	Resume bool `json:"resume"`
+	// Checkpoint is the checkpoint to resume from, the latest one if empty
+	Checkpoint string `json:"checkpoint"`
+}
+
+func jobAttempt(job *batchv1.Job) int {
+	if n, err := strconv.Atoi(job.Annotations[annotationAttempt]); err == nil && n > 0 {
+		return n
+	}
+
+	return 1
+}
+
+// latestCheckpoint returns the checkpoint of job which is modified lastly
+func latestCheckpoint(jobName string) (string, error) {
+	dir, err := jobOutputDir(jobName)
+	if err != nil {
+		return "", err
+	}
+
+	items, err := listArtifacts(dir)
+	if err != nil {
+		return "", err
+	}
+
+	r, modTime := "", ""
+	for i := range items {
+		if v := &items[i]; v.Kind == artifactCheckpoint && v.ModTime >= modTime {
+			r, modTime = v.Path, v.ModTime
+		}
+	}
+
+	if r == "" {
+		return "", allerror.NewNotFound(fmt.Sprintf("no checkpoint of job %s", jobName))
+	}
+
+	return r, nil
+}
+
+// resumeCheckpoint returns the path of checkpoint in the output volume
+func resumeCheckpoint(jobName string, req *RetryRequest) (string, error) {
+	if !hasOutputVolume() {
+		return "", allerror.New(allerror.ErrorFinetune, "resuming is not enabled without output volume")
+	}
+
+	name := req.Checkpoint
+	if name == "" {
+		v, err := latestCheckpoint(jobName)
+		if err != nil {
+			return "", err
+		}
+
+		name = v
+	}
+
+	p, err := subPath(filepath.Join(jobName, name))
+	if err != nil || !strings.HasPrefix(p, jobName+"/") {
+		return "", allerror.New(allerror.ErrorBadRequestParam, "invalid checkpoint")
+	}
+
+	if _, err := os.Stat(filepath.Join(artifactCfg.Dir, p)); err != nil {
+		if os.IsNotExist(err) {
+			return "", allerror.NewNotFound(fmt.Sprintf("checkpoint %s not found", name))
+		}
+
+		return "", err
+	}
+
+	return p, nil
+}
+
+// doRetryJob creates a new attempt of the finished job with the same parameters in the same cluster,
+// where its checkpoints are.
+func doRetryJob(jobName, secret string, req *RetryRequest) (*batchv1.Job, error) {
+	job, err := getJob(jobName)
+	if err != nil {
+		logrus.Error(err.Error())
+		return nil, fmt.Errorf("get job info failed")
+	}
+
+	if status := jobStatus(job); !isTerminalStatus(status) {
+		return nil, allerror.New(allerror.ErrorFinetune, fmt.Sprintf("job %s is %s", jobName, status))
+	}
+
+	tpl, err := getTemplate(job.Labels["template"])
+	if err != nil {
+		return nil, err
+	}
+
+	model, err := getModel(job.Labels["model"], tpl)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkDatasetExists(job.Labels["data"]); err != nil {
+		return nil, err
+	}
+
+	params, err := getEnvs(job, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// the environments which are set for every job are not the parameters
+	delete(params, strings.ToLower(envOutputDir))
+	delete(params, strings.ToLower(envResumeFrom))
+	delete(params, strings.ToLower(envSecret))
+	for _, v := range distributedEnvs {
+		delete(params, strings.ToLower(v))
+	}
+
+	jobInfo := JobInfo{
+		Username:      job.Labels["create_by"],
+		Dataset:       job.Labels["data"],
+		Model:         job.Labels["model"],
+		Template:      tpl.Name,
+		Parameter:     params,
+		RetryOf:       jobName,
+		Attempt:       jobAttempt(job) + 1,
+		Priority:      jobPriority(job),
+		Evals:         jobEvalSuites(job),
+		RetentionDays: jobRetentionDays(job),
+	}
+
+	cl, err := clusterOf(job)
+	if err != nil {
+		logrus.Error(err.Error())
+		return nil, fmt.Errorf("get job info failed")
+	}
+	jobInfo.Cluster = cl.Name
+
+	if jobInfo.Credentials, err = jobCredentials(cl, jobName); err != nil {
+		logrus.Error(err.Error())
+		return nil, fmt.Errorf("get job info failed")
+	}
+
+	if req.Resume {
+		if jobInfo.ResumeFrom, err = resumeCheckpoint(jobName, req); err != nil {
+			return nil, err
+		}
+	}
+
+	return doCreateJob(cl, tpl, model, &jobInfo, secret)
+}
+
+// @Summary		Retry
+// @Description	create a new attempt of a finished finetune with the same parameters
+// @Tags			Finetune
+// @Param			jobname	path	string			true	"finetune id"
+// @Param			body	body	RetryRequest	false	"body of retrying finetune"
+// @Accept			json
+// @Success		200	{object}		JobInfo
+// @Failure		500	system_error	system	error
+// @Router			/v1/job/{jobname}/retry [post]
+func retryJob(c *gin.Context) {
+	jobName := c.Param("jobname")
+	secret := c.GetHeader(headerSecret)
+
+	var req RetryRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			commonctl.SendBadRequestBody(c, err)
+			logrus.Error(err.Error())
+			return
+		}
+	}
+
+	if err := checkJobPerm(jobName, secret, "retry"); err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	job, err := doRetryJob(jobName, secret, &req)
+	if err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	admission.notify()
+	collectors.start(job.Name)
+
+	info, err := toJobInfo(job)
+	if err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+	info.Status = statusQueued
+
+	c.JSON(http.StatusOK, info)
+}
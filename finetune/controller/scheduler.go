@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	backendDefault = "default"
+	backendVolcano = "volcano"
+	backendKueue   = "kueue"
+
+	volcanoSchedulerName    = "volcano"
+	annotationVolcanoGroup  = "scheduling.k8s.io/group-name"
+	labelKueueQueueName     = "kueue.x-k8s.io/queue-name"
+	labelKueuePriorityClass = "kueue.x-k8s.io/priority-class"
+)
+
+var (
+	schedulerCfg SchedulerConfig
+
+	podGroupResource = schema.GroupVersionResource{
+		Group:    "scheduling.volcano.sh",
+		Version:  "v1beta1",
+		Resource: "podgroups",
+	}
+)
+
+// SchedulerConfig selects the batch scheduler which schedules the pods of jobs.
+// The jobs are always the jobs of kubernetes, so the status is the same for every backend.
+//
+// The volcano backend doesn't create the jobs of volcano (batch.volcano.sh/v1alpha1).
+// The jobs of kubernetes are scheduled by volcano with a pod group created for each of
+// them, which gangs their pods in the queue of volcano. So the cache, the status, the
+// logs, the cancellation, the retries and the reaper work with the same jobs for every
+// backend, and the clusters don't need the job controller of volcano. The plugins of
+// the jobs of volcano (svc, ssh and env) are not available, the rendezvous service and
+// the environments of distributed jobs are set by the server instead.
+type SchedulerConfig struct {
+	// Backend is one of default, volcano and kueue
+	Backend string `json:"backend"`
+	// QueueName is the queue of volcano or the local queue of kueue
+	QueueName string `json:"queue_name"`
+	// PriorityClass is the priority class of pods for volcano or the workload priority class for kueue
+	PriorityClass string `json:"priority_class"`
+}
+
+func (cfg *SchedulerConfig) setDefault() {
+	if cfg.Backend == "" {
+		cfg.Backend = backendDefault
+	}
+
+	if cfg.QueueName == "" && cfg.Backend != backendDefault {
+		cfg.QueueName = "default"
+	}
+}
+
+func (cfg *SchedulerConfig) validate() error {
+	switch cfg.Backend {
+	case backendDefault, backendVolcano, backendKueue:
+		return nil
+	default:
+		return fmt.Errorf("unknown scheduler backend: %s", cfg.Backend)
+	}
+}
+
+// schedulesCapacity checks whether the backend admits the pods by the capacity of cluster itself
+func (cfg *SchedulerConfig) schedulesCapacity() bool {
+	return cfg.Backend != backendDefault
+}
+
+// setupJob sets the job to be scheduled by the backend before it is created
+func (cfg *SchedulerConfig) setupJob(job *batchv1.Job) {
+	if cfg.Backend != backendVolcano {
+		return
+	}
+
+	spec := &job.Spec.Template.Spec
+	spec.SchedulerName = volcanoSchedulerName
+	spec.PriorityClassName = cfg.PriorityClass
+
+	if job.Spec.Template.Annotations == nil {
+		job.Spec.Template.Annotations = map[string]string{}
+	}
+	job.Spec.Template.Annotations[annotationVolcanoGroup] = job.Name
+}
+
+// afterCreate creates the pod group of volcano which schedules all the pods of job as a gang,
+// the pod group is deleted with the job.
+func (cfg *SchedulerConfig) afterCreate(cl *cluster, job *batchv1.Job) error {
+	if cfg.Backend != backendVolcano {
+		return nil
+	}
+
+	minMember := int64(1)
+	if job.Spec.Parallelism != nil && *job.Spec.Parallelism > 1 {
+		minMember = int64(*job.Spec.Parallelism)
+	}
+
+	spec := map[string]interface{}{
+		"minMember": minMember,
+		"queue":     cfg.QueueName,
+	}
+	if cfg.PriorityClass != "" {
+		spec["priorityClassName"] = cfg.PriorityClass
+	}
+
+	pg := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": podGroupResource.GroupVersion().String(),
+		"kind":       "PodGroup",
+		"metadata": map[string]interface{}{
+			"name":      job.Name,
+			"namespace": cl.Namespace,
+			"ownerReferences": []interface{}{
+				map[string]interface{}{
+					"apiVersion":         batchv1.SchemeGroupVersion.String(),
+					"kind":               "Job",
+					"name":               job.Name,
+					"uid":                string(job.UID),
+					"controller":         true,
+					"blockOwnerDeletion": true,
+				},
+			},
+		},
+		"spec": spec,
+	}}
+
+	_, err := cl.dynamic.Resource(podGroupResource).Namespace(cl.Namespace).Create(
+		context.TODO(), pg, metav1.CreateOptions{},
+	)
+
+	return err
+}
+
+// admitPatch is the patch which hands the job admitted by the queue over to the backend.
+// Kueue resumes the job itself after it admits the workload of the job.
+func (cfg *SchedulerConfig) admitPatch() map[string]interface{} {
+	if cfg.Backend == backendKueue {
+		labels := map[string]interface{}{labelKueueQueueName: cfg.QueueName}
+		if cfg.PriorityClass != "" {
+			labels[labelKueuePriorityClass] = cfg.PriorityClass
+		}
+
+		return map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]interface{}{annotationQueued: nil},
+				"labels":      labels,
+			},
+		}
+	}
+
+	return map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{annotationQueued: nil},
+		},
+		"spec": map[string]interface{}{"suspend": false},
+	}
+}
+
+// cancelSpec is the change of spec which stops the job. Kueue resumes the suspended job
+// if its workload is admitted, so the job managed by kueue is stopped by the deadline.
+func cancelSpec(job *batchv1.Job) map[string]interface{} {
+	if job.Labels[labelKueueQueueName] != "" {
+		return map[string]interface{}{"activeDeadlineSeconds": 1}
+	}
+
+	return map[string]interface{}{"suspend": true}
+}
+
+// waitingForKueue checks whether the job is waiting for the admission of kueue
+func waitingForKueue(job *batchv1.Job) bool {
+	return job.Labels[labelKueueQueueName] != "" && job.Spec.Suspend != nil && *job.Spec.Suspend
+}
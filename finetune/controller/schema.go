@@ -0,0 +1,239 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opensourceways/foundation-model-server/allerror"
+	commonctl "github.com/opensourceways/foundation-model-server/common/controller"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	paramTypeInt   = "int"
+	paramTypeFloat = "float"
+	paramTypeEnum  = "enum"
+	paramTypeBool  = "bool"
+)
+
+var (
+	paramNameRe = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+	// reservedParams are set by the server and can't be declared or passed by users
+	reservedParams = map[string]bool{
+		"secret":     true,
+		"model_name": true,
+		"dataset":    true,
+		"npu_number": true,
+		"output_dir": true,
+	}
+
+	// runtimeEnvs are the environments of the runtime which the parameters can't override
+	runtimeEnvs = map[string]bool{
+		"PATH":            true,
+		"HOME":            true,
+		"LD_PRELOAD":      true,
+		"LD_LIBRARY_PATH": true,
+		"PYTHONPATH":      true,
+	}
+)
+
+// ParameterSchema describes a hyperparameter accepted by a template
+type ParameterSchema struct {
+	Name        string   `json:"name"        required:"true"`
+	Type        string   `json:"type"        required:"true"`
+	Min         *float64 `json:"min,omitempty"`
+	Max         *float64 `json:"max,omitempty"`
+	Values      []string `json:"values,omitempty"`
+	Default     string   `json:"default,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+func (p *ParameterSchema) validate() error {
+	if !paramNameRe.MatchString(p.Name) {
+		return fmt.Errorf("invalid parameter name: %s", p.Name)
+	}
+
+	if reservedParams[p.Name] {
+		return fmt.Errorf("parameter %s is reserved", p.Name)
+	}
+
+	switch p.Type {
+	case paramTypeInt, paramTypeFloat, paramTypeBool:
+	case paramTypeEnum:
+		if len(p.Values) == 0 {
+			return fmt.Errorf("missing values of enum parameter %s", p.Name)
+		}
+	default:
+		return fmt.Errorf("unknown type %s of parameter %s", p.Type, p.Name)
+	}
+
+	if p.Min != nil && p.Max != nil && *p.Min > *p.Max {
+		return fmt.Errorf("invalid range of parameter %s", p.Name)
+	}
+
+	if p.Default != "" {
+		return p.check(p.Default)
+	}
+
+	return nil
+}
+
+func (p *ParameterSchema) check(v string) error {
+	switch p.Type {
+	case paramTypeInt:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("parameter %s must be an integer", p.Name)
+		}
+
+		return p.checkRange(float64(n))
+
+	case paramTypeFloat:
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("parameter %s must be a number", p.Name)
+		}
+
+		return p.checkRange(n)
+
+	case paramTypeBool:
+		if _, err := strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("parameter %s must be a boolean", p.Name)
+		}
+
+	case paramTypeEnum:
+		for _, item := range p.Values {
+			if item == v {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("parameter %s must be one of %v", p.Name, p.Values)
+	}
+
+	return nil
+}
+
+func (p *ParameterSchema) checkRange(n float64) error {
+	if p.Min != nil && n < *p.Min {
+		return fmt.Errorf("parameter %s must be >= %v", p.Name, *p.Min)
+	}
+
+	if p.Max != nil && n > *p.Max {
+		return fmt.Errorf("parameter %s must be <= %v", p.Name, *p.Max)
+	}
+
+	return nil
+}
+
+func (t *JobTemplate) validateSchema() error {
+	names := make(map[string]bool, len(t.Schema))
+	for i := range t.Schema {
+		p := &t.Schema[i]
+
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("template %s: %s", t.Name, err.Error())
+		}
+
+		if names[p.Name] {
+			return fmt.Errorf("template %s: duplicate parameter %s", t.Name, p.Name)
+		}
+		names[p.Name] = true
+	}
+
+	if err := t.checkParameters(t.Parameters); err != nil {
+		return fmt.Errorf("template %s: %s", t.Name, err.Error())
+	}
+
+	return nil
+}
+
+func (t *JobTemplate) paramSchema(name string) *ParameterSchema {
+	for i := range t.Schema {
+		if t.Schema[i].Name == name {
+			return &t.Schema[i]
+		}
+	}
+
+	return nil
+}
+
+// isReservedEnv checks whether the environment is set by the server or the runtime
+func isReservedEnv(name string) bool {
+	switch name {
+	case envSecret, envOutputDir, envResumeFrom:
+		return true
+	}
+
+	for _, v := range distributedEnvs {
+		if v == name {
+			return true
+		}
+	}
+
+	return runtimeEnvs[name]
+}
+
+// checkParamName rejects the parameter which is set by the server, it is passed by the
+// environment of the same name in upper case.
+func checkParamName(name string) error {
+	if !paramNameRe.MatchString(name) || reservedParams[name] || isReservedEnv(strings.ToUpper(name)) {
+		return allerror.New(allerror.ErrorBadRequestParam, fmt.Sprintf("invalid parameter: %s", name))
+	}
+
+	return nil
+}
+
+// checkParameters rejects the parameters which are reserved, not declared by the schema or invalid.
+// The template without schema, such as the default one, accepts any other parameter.
+func (t *JobTemplate) checkParameters(parameter map[string]string) error {
+	for k, v := range parameter {
+		if err := checkParamName(k); err != nil {
+			return err
+		}
+
+		if len(t.Schema) == 0 {
+			continue
+		}
+
+		p := t.paramSchema(k)
+		if p == nil {
+			return allerror.New(allerror.ErrorBadRequestParam, fmt.Sprintf("unknown parameter: %s", k))
+		}
+
+		if err := p.check(v); err != nil {
+			return allerror.New(allerror.ErrorBadRequestParam, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// @Summary		Schema
+// @Description	get the parameter schema of a finetune template
+// @Tags			Finetune
+// @Param			name	path	string	true	"template name"
+// @Accept			json
+// @Success		200	{object}		[]ParameterSchema
+// @Failure		500	system_error	system	error
+// @Router			/v1/finetune/templates/{name}/schema [get]
+func getTemplateSchema(c *gin.Context) {
+	tpl, err := getTemplate(c.Param("name"))
+	if err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	schema := tpl.Schema
+	if schema == nil {
+		schema = []ParameterSchema{}
+	}
+
+	c.JSON(http.StatusOK, schema)
+}
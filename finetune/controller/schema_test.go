@@ -0,0 +1,94 @@
+package controller
+
+import "testing"
+
+func TestParameterSchemaCheck(t *testing.T) {
+	min, max := 1.0, 10.0
+
+	cases := []struct {
+		name    string
+		schema  ParameterSchema
+		value   string
+		wantErr bool
+	}{
+		{"int", ParameterSchema{Name: "epochs", Type: paramTypeInt}, "3", false},
+		{"int of float", ParameterSchema{Name: "epochs", Type: paramTypeInt}, "3.5", true},
+		{"int in range", ParameterSchema{Name: "epochs", Type: paramTypeInt, Min: &min, Max: &max}, "10", false},
+		{"int below min", ParameterSchema{Name: "epochs", Type: paramTypeInt, Min: &min}, "0", true},
+		{"int above max", ParameterSchema{Name: "epochs", Type: paramTypeInt, Max: &max}, "11", true},
+		{"float", ParameterSchema{Name: "lr", Type: paramTypeFloat}, "1e-4", false},
+		{"float of text", ParameterSchema{Name: "lr", Type: paramTypeFloat}, "fast", true},
+		{"bool", ParameterSchema{Name: "fp16", Type: paramTypeBool}, "true", false},
+		{"bool of text", ParameterSchema{Name: "fp16", Type: paramTypeBool}, "yes", true},
+		{"enum", ParameterSchema{Name: "opt", Type: paramTypeEnum, Values: []string{"adam", "sgd"}}, "sgd", false},
+		{"enum of unknown", ParameterSchema{Name: "opt", Type: paramTypeEnum, Values: []string{"adam", "sgd"}}, "lion", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.schema.check(tc.value); (err != nil) != tc.wantErr {
+				t.Errorf("check(%s) error = %v, wantErr %v", tc.value, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckParameters(t *testing.T) {
+	withSchema := &JobTemplate{
+		Name:   "lora",
+		Schema: []ParameterSchema{{Name: "epochs", Type: paramTypeInt}},
+	}
+	withoutSchema := &JobTemplate{Name: defaultTemplateName}
+
+	cases := []struct {
+		name      string
+		tpl       *JobTemplate
+		parameter map[string]string
+		wantErr   bool
+	}{
+		{"declared", withSchema, map[string]string{"epochs": "3"}, false},
+		{"invalid", withSchema, map[string]string{"epochs": "three"}, true},
+		{"unknown", withSchema, map[string]string{"batch_size": "8"}, true},
+		{"reserved", withSchema, map[string]string{"output_dir": "/tmp"}, true},
+		{"no schema", withoutSchema, map[string]string{"batch_size": "8"}, false},
+		{"no schema reserved", withoutSchema, map[string]string{"secret": "x"}, true},
+		{"no schema output dir", withoutSchema, map[string]string{"output_dir": "/tmp"}, true},
+		{"no schema server env", withoutSchema, map[string]string{"master_addr": "x"}, true},
+		{"no schema runtime env", withoutSchema, map[string]string{"ld_preload": "/tmp/a.so"}, true},
+		{"no schema path", withoutSchema, map[string]string{"path": "/tmp"}, true},
+		{"no schema invalid name", withoutSchema, map[string]string{"Batch-Size": "8"}, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.tpl.checkParameters(tc.parameter); (err != nil) != tc.wantErr {
+				t.Errorf("checkParameters error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckCredentials(t *testing.T) {
+	tpl := &JobTemplate{Name: defaultTemplateName, Parameters: map[string]string{"epochs": "3"}}
+
+	cases := []struct {
+		name        string
+		parameter   map[string]string
+		credentials map[string]string
+		wantErr     bool
+	}{
+		{"valid", map[string]string{"batch_size": "8"}, map[string]string{"HF_TOKEN": "x"}, false},
+		{"server env", nil, map[string]string{"OUTPUT_DIR": "x"}, true},
+		{"runtime env", nil, map[string]string{"LD_PRELOAD": "x"}, true},
+		{"parameter", map[string]string{"hf_token": "x"}, map[string]string{"HF_TOKEN": "x"}, true},
+		{"default parameter", nil, map[string]string{"EPOCHS": "x"}, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := checkCredentials(tpl, tc.parameter, tc.credentials); (err != nil) != tc.wantErr {
+				t.Errorf("checkCredentials error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
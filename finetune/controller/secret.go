@@ -0,0 +1,233 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/opensourceways/foundation-model-server/allerror"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// annotationOwner is the hash of token which created the job
+	annotationOwner = "finetune/owner"
+
+	envSecret         = "SECRET"
+	credentialsSuffix = "-credentials"
+	maxCredentials    = 32
+)
+
+var credentialNameRe = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+func ownerHash(token string) string {
+	v := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(v[:])
+}
+
+// isOwner checks whether the job is created by the token. The jobs created before the
+// owner is recorded keep the token in the environment.
+func isOwner(job *batchv1.Job, token string) (bool, error) {
+	if h := job.Annotations[annotationOwner]; h != "" {
+		return subtle.ConstantTimeCompare([]byte(h), []byte(ownerHash(token))) == 1, nil
+	}
+
+	params, err := getEnvs(job, false)
+	if err != nil {
+		return false, err
+	}
+
+	s, ok := params[strings.ToLower(envSecret)]
+
+	return !ok || s == token, nil
+}
+
+// jobOwnerHash returns the hash of token which created the job, it is empty if the
+// job is created before the owner is recorded and without the token.
+func jobOwnerHash(job *batchv1.Job) string {
+	if h := job.Annotations[annotationOwner]; h != "" {
+		return h
+	}
+
+	params, err := getEnvs(job, false)
+	if err != nil {
+		return ""
+	}
+
+	if s, ok := params[strings.ToLower(envSecret)]; ok {
+		return ownerHash(s)
+	}
+
+	return ""
+}
+
+// checkCredentials checks the credentials passed to the job, they must not be the
+// environments set by the server or the parameters.
+func checkCredentials(tpl *JobTemplate, parameter, credentials map[string]string) error {
+	if len(credentials) > maxCredentials {
+		return allerror.New(allerror.ErrorBadRequestParam, fmt.Sprintf("too many credentials, max is %d", maxCredentials))
+	}
+
+	for k := range credentials {
+		name := strings.ToLower(k)
+		_, isParam := parameter[name]
+		_, isDefault := tpl.Parameters[name]
+
+		if !credentialNameRe.MatchString(k) || isReservedEnv(k) || reservedParams[name] ||
+			isParam || isDefault || tpl.paramSchema(name) != nil {
+			return allerror.New(allerror.ErrorBadRequestParam, fmt.Sprintf("invalid credential: %s", k))
+		}
+	}
+
+	return nil
+}
+
+func credentialsSecretName(jobName string) string {
+	return servicePrefix + jobName + credentialsSuffix
+}
+
+// credentialEnvs are the environments read from the secret of job
+func credentialEnvs(jobName string, credentials map[string]string) []corev1.EnvVar {
+	names := make([]string, 0, len(credentials)+1)
+	for k := range credentials {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	names = append([]string{envSecret}, names...)
+
+	r := make([]corev1.EnvVar, 0, len(names))
+	for _, k := range names {
+		r = append(r, corev1.EnvVar{
+			Name: k,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: credentialsSecretName(jobName)},
+					Key:                  k,
+				},
+			},
+		})
+	}
+
+	return r
+}
+
+func credentialsData(secret string, credentials map[string]string) map[string]string {
+	data := make(map[string]string, len(credentials)+1)
+	for k, v := range credentials {
+		data[k] = v
+	}
+	data[envSecret] = secret
+
+	return data
+}
+
+// createCredentialsSecret saves the token and the credentials of job in a secret owned by the job
+func createCredentialsSecret(
+	cl *cluster, job *batchv1.Job, secret string, credentials map[string]string,
+) error {
+	data := credentialsData(secret, credentials)
+
+	s := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      credentialsSecretName(job.Name),
+			Namespace: cl.Namespace,
+			Labels:    map[string]string{labelFinetuneJob: job.Name},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(job, batchv1.SchemeGroupVersion.WithKind("Job")),
+			},
+		},
+		Type:       corev1.SecretTypeOpaque,
+		StringData: data,
+	}
+
+	_, err := cl.clientset.CoreV1().Secrets(cl.Namespace).Create(context.TODO(), s, metav1.CreateOptions{})
+
+	return err
+}
+
+// jobCredentials returns the credentials of job except the token
+func jobCredentials(cl *cluster, jobName string) (map[string]string, error) {
+	_, r, err := readCredentialsSecret(cl, credentialsSecretName(jobName))
+	if err != nil && isNotFound(err) {
+		return nil, nil
+	}
+
+	return r, err
+}
+
+// readCredentialsSecret returns the token and the other credentials saved in the secret
+func readCredentialsSecret(cl *cluster, name string) (string, map[string]string, error) {
+	s, err := cl.clientset.CoreV1().Secrets(cl.Namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return "", nil, err
+	}
+
+	r := make(map[string]string, len(s.Data))
+	for k, v := range s.Data {
+		if k != envSecret {
+			r[k] = string(v)
+		}
+	}
+
+	return string(s.Data[envSecret]), r, nil
+}
+
+func deleteCredentialsSecret(cl *cluster, jobName string) error {
+	err := cl.clientset.CoreV1().Secrets(cl.Namespace).Delete(
+		context.TODO(), credentialsSecretName(jobName), metav1.DeleteOptions{},
+	)
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+// the secret of sweep is in the first cluster, the trials copy it to the secrets of their jobs
+func sweepSecretName(id string) string {
+	return servicePrefix + "sweep-" + id + credentialsSuffix
+}
+
+// createSweepSecret saves the token and the credentials by which the trials of sweep are created
+func createSweepSecret(id, secret string, credentials map[string]string) error {
+	cl := clusters[0]
+
+	s := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      sweepSecretName(id),
+			Namespace: cl.Namespace,
+			Labels:    map[string]string{labelSweep: id},
+		},
+		Type:       corev1.SecretTypeOpaque,
+		StringData: credentialsData(secret, credentials),
+	}
+
+	_, err := cl.clientset.CoreV1().Secrets(cl.Namespace).Create(context.TODO(), s, metav1.CreateOptions{})
+
+	return err
+}
+
+func sweepCredentials(id string) (string, map[string]string, error) {
+	return readCredentialsSecret(clusters[0], sweepSecretName(id))
+}
+
+func deleteSweepSecret(id string) error {
+	cl := clusters[0]
+
+	err := cl.clientset.CoreV1().Secrets(cl.Namespace).Delete(
+		context.TODO(), sweepSecretName(id), metav1.DeleteOptions{},
+	)
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,737 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/opensourceways/foundation-model-server/allerror"
+	commonctl "github.com/opensourceways/foundation-model-server/common/controller"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	annotationSweep = "finetune/sweep"
+	labelSweep      = "sweep"
+
+	sweepGrid   = "grid"
+	sweepRandom = "random"
+
+	sweepGoalMin = "min"
+	sweepGoalMax = "max"
+
+	sweepRunning   = "Running"
+	sweepComplete  = "Complete"
+	sweepCancelled = "Cancelled"
+
+	// trialPending is the status of trial whose job is not created yet
+	trialPending = "Pending"
+	// trialDeleted is the status of trial whose job is deleted before it finishes
+	trialDeleted = "Deleted"
+)
+
+var (
+	sweepCfg SweepConfig
+	sweeps   *sweepRunner
+
+	// sweepGoals are the default goals of the metrics which a sweep can optimize
+	sweepGoals = map[string]string{
+		metricLoss:       sweepGoalMin,
+		metricThroughput: sweepGoalMax,
+	}
+)
+
+// sweepStore saves the sweeps with the owner by which their jobs are created
+type sweepStore interface {
+	Save(r *sweepRecord) error
+	Get(id string) (sweepRecord, error)
+	List() ([]sweepRecord, error)
+}
+
+// SweepConfig
+type SweepConfig struct {
+	Dir string `json:"dir"`
+	// Interval is the seconds between two rounds of checking the trials
+	Interval int `json:"interval"`
+	// MaxTrials is the max number of jobs of a sweep
+	MaxTrials int `json:"max_trials"`
+	// MaxParallel is the max number of jobs of a sweep running at the same time
+	MaxParallel int `json:"max_parallel"`
+}
+
+func (cfg *SweepConfig) setDefault() {
+	if cfg.Dir == "" {
+		cfg.Dir = "/data/disk1/sweeps"
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10
+	}
+
+	if cfg.MaxTrials <= 0 {
+		cfg.MaxTrials = 50
+	}
+
+	if cfg.MaxParallel <= 0 {
+		cfg.MaxParallel = 4
+	}
+}
+
+// SweepRequest is the body of creating a sweep
+type SweepRequest struct {
+	// Base is the job of which the parameters are overridden by every trial
+	Base JobInfo `json:"base"   required:"true"`
+	// Method is grid or random, default grid
+	Method string `json:"method"`
+	// Space is the values to search of every parameter
+	Space map[string][]string `json:"space"  required:"true"`
+	// Samples is the number of configurations sampled by the random search
+	Samples int `json:"samples"`
+	// MaxParallel is the max number of jobs running at the same time
+	MaxParallel int `json:"max_parallel"`
+	// Metric is the final metric of job to compare, loss or throughput, default loss
+	Metric string `json:"metric"`
+	// Goal is min or max, it depends on the metric by default
+	Goal string `json:"goal"`
+}
+
+// SweepTrial is a configuration of the sweep and its job
+type SweepTrial struct {
+	Parameter map[string]string `json:"parameter"`
+	JobName   string            `json:"jobName,omitempty"`
+	Status    string            `json:"status"`
+	Metric    *float64          `json:"metric,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+func (t *SweepTrial) isDone() bool {
+	return t.Status == trialDeleted || isTerminalStatus(t.Status)
+}
+
+// SweepInfo
+type SweepInfo struct {
+	ID          string       `json:"id"`
+	Username    string       `json:"username"`
+	Base        JobInfo      `json:"base"`
+	Method      string       `json:"method"`
+	Metric      string       `json:"metric"`
+	Goal        string       `json:"goal"`
+	MaxParallel int          `json:"max_parallel"`
+	CreatedAt   string       `json:"created_at"`
+	Status      string       `json:"status"`
+	Trials      []SweepTrial `json:"trials"`
+	Best        *SweepTrial  `json:"best,omitempty"`
+}
+
+// sweepRecord is the sweep saved in the store. The token and credentials by which the
+// trials are created are saved in the secret of sweep, only the hash of token is recorded.
+type sweepRecord struct {
+	SweepInfo
+
+	Owner string `json:"owner"`
+}
+
+// checkOwner checks whether the sweep is created by the token
+func (s *sweepRecord) checkOwner(secret string) error {
+	if s.Owner == "" || subtle.ConstantTimeCompare([]byte(s.Owner), []byte(ownerHash(secret))) != 1 {
+		return allerror.New(allerror.ErrorPermissionDeny, "Permission denied, you can't cancel sweeps created by others")
+	}
+
+	return nil
+}
+
+func (req *SweepRequest) validate() error {
+	if req.Method == "" {
+		req.Method = sweepGrid
+	}
+
+	if req.Method != sweepGrid && req.Method != sweepRandom {
+		return fmt.Errorf("unknown sweep method: %s", req.Method)
+	}
+
+	if len(req.Space) == 0 {
+		return errors.New("empty search space")
+	}
+
+	for k, v := range req.Space {
+		if len(v) == 0 {
+			return fmt.Errorf("no value of parameter %s to search", k)
+		}
+	}
+
+	if req.Metric == "" {
+		req.Metric = metricLoss
+	}
+
+	goal, ok := sweepGoals[req.Metric]
+	if !ok {
+		return fmt.Errorf("metric %s can't be optimized", req.Metric)
+	}
+
+	if req.Goal == "" {
+		req.Goal = goal
+	}
+
+	if req.Goal != sweepGoalMin && req.Goal != sweepGoalMax {
+		return fmt.Errorf("invalid goal: %s", req.Goal)
+	}
+
+	if req.MaxParallel <= 0 || req.MaxParallel > sweepCfg.MaxParallel {
+		req.MaxParallel = sweepCfg.MaxParallel
+	}
+
+	base := &req.Base
+	if base.Username == "" || base.Dataset == "" || base.Model == "" {
+		return errors.New("invalid base job")
+	}
+
+	if base.Priority < 0 || base.Priority > admission.cfg.MaxPriority {
+		return fmt.Errorf("invalid priority, it should be in [0, %d]", admission.cfg.MaxPriority)
+	}
+
+	base.RetryOf, base.Attempt, base.ResumeFrom, base.Sweep = "", 0, "", ""
+	base.EvalResults = nil
+
+	return nil
+}
+
+// check checks the base job and every value of the space before any job is created
+func (req *SweepRequest) check() error {
+	tpl, err := getTemplate(req.Base.Template)
+	if err != nil {
+		return err
+	}
+	req.Base.Template = tpl.Name
+
+	if err := tpl.checkParameters(req.Base.Parameter); err != nil {
+		return err
+	}
+
+	// the parameters of trials are the base ones and the ones of space
+	params := make(map[string]string, len(req.Base.Parameter)+len(req.Space))
+	for k, v := range req.Base.Parameter {
+		params[k] = v
+	}
+
+	for k, values := range req.Space {
+		for _, v := range values {
+			if err := tpl.checkParameters(map[string]string{k: v}); err != nil {
+				return err
+			}
+		}
+		params[k] = ""
+	}
+
+	if err := checkCredentials(tpl, params, req.Base.Credentials); err != nil {
+		return err
+	}
+
+	if _, err := getModel(req.Base.Model, tpl); err != nil {
+		return err
+	}
+
+	return checkDatasetExists(req.Base.Dataset)
+}
+
+// trials returns the configurations to run, the grid has all the combinations of values
+// and the random search samples different combinations of them.
+func (req *SweepRequest) trials() ([]SweepTrial, error) {
+	keys := make([]string, 0, len(req.Space))
+	for k := range req.Space {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// size saturates at MaxInt32, it is much larger than the max trials
+	size := 1
+	for _, k := range keys {
+		if size *= len(req.Space[k]); size > math.MaxInt32 {
+			size = math.MaxInt32
+		}
+	}
+
+	var indexes []int
+
+	switch req.Method {
+	case sweepGrid:
+		if size > sweepCfg.MaxTrials {
+			return nil, fmt.Errorf("too many trials of grid: %d, max is %d", size, sweepCfg.MaxTrials)
+		}
+
+		indexes = make([]int, size)
+		for i := range indexes {
+			indexes[i] = i
+		}
+
+	case sweepRandom:
+		n := req.Samples
+		if n <= 0 || n > sweepCfg.MaxTrials {
+			return nil, fmt.Errorf("samples should be in [1, %d]", sweepCfg.MaxTrials)
+		}
+
+		if n > size {
+			n = size
+		}
+
+		seen := make(map[int]bool, n)
+		for len(indexes) < n {
+			if i := rand.Intn(size); !seen[i] {
+				seen[i] = true
+				indexes = append(indexes, i)
+			}
+		}
+	}
+
+	r := make([]SweepTrial, len(indexes))
+	for i, index := range indexes {
+		params := make(map[string]string, len(keys))
+		for j := len(keys) - 1; j >= 0; j-- {
+			values := req.Space[keys[j]]
+			params[keys[j]] = values[index%len(values)]
+			index /= len(values)
+		}
+
+		r[i] = SweepTrial{Parameter: params, Status: trialPending}
+	}
+
+	return r, nil
+}
+
+// finalMetric returns the last value of the metric which the job reported
+func finalMetric(jobName, metric string) (*float64, error) {
+	points, err := metrics.List(jobName)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(points) - 1; i >= 0; i-- {
+		p := &points[i]
+
+		switch metric {
+		case metricLoss:
+			if p.Loss != nil {
+				return p.Loss, nil
+			}
+		case metricThroughput:
+			if p.Throughput != nil {
+				return p.Throughput, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// sweepRunner creates the jobs of running sweeps in background and collects their metrics
+type sweepRunner struct {
+	store   sweepStore
+	trigger chan struct{}
+	// mutex serializes the updates of sweeps
+	mutex sync.Mutex
+}
+
+func newSweepRunner(store sweepStore) *sweepRunner {
+	return &sweepRunner{
+		store:   store,
+		trigger: make(chan struct{}, 1),
+	}
+}
+
+func (r *sweepRunner) notify() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (r *sweepRunner) run() {
+	interval := time.Duration(sweepCfg.Interval) * time.Second
+
+	for {
+		if err := r.progressAll(); err != nil {
+			logrus.Errorf("progress sweeps failed, err:%s", err.Error())
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-r.trigger:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+func (r *sweepRunner) progressAll() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	items, err := r.store.List()
+	if err != nil {
+		return err
+	}
+
+	for i := range items {
+		s := &items[i]
+		if s.Status != sweepRunning {
+			continue
+		}
+
+		r.progress(s)
+
+		if s.Status != sweepRunning {
+			if err := deleteSweepSecret(s.ID); err != nil {
+				logrus.Errorf("delete secret of sweep %s failed, err:%s", s.ID, err.Error())
+			}
+		}
+
+		if err := r.store.Save(s); err != nil {
+			logrus.Errorf("save sweep %s failed, err:%s", s.ID, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// progress updates the trials by their jobs, creates the jobs of pending trials
+// within the max parallel and chooses the best trial.
+func (r *sweepRunner) progress(s *sweepRecord) {
+	active := 0
+
+	for i := range s.Trials {
+		t := &s.Trials[i]
+		if t.JobName == "" || t.isDone() {
+			continue
+		}
+
+		job, err := jobs.getJob(t.JobName)
+		if err != nil {
+			if isNotFound(err) {
+				t.Status = trialDeleted
+			} else {
+				logrus.Errorf("get job %s of sweep %s failed, err:%s", t.JobName, s.ID, err.Error())
+				active++
+			}
+
+			continue
+		}
+
+		t.Status = jobStatus(job)
+		if !t.isDone() {
+			active++
+
+			continue
+		}
+
+		if t.Metric, err = finalMetric(t.JobName, s.Metric); err != nil {
+			logrus.Errorf("get metrics of job %s failed, err:%s", t.JobName, err.Error())
+		}
+	}
+
+	var secret string
+	var credentials map[string]string
+	loaded := false
+
+	for i := range s.Trials {
+		if active >= s.MaxParallel {
+			break
+		}
+
+		t := &s.Trials[i]
+		if t.Status != trialPending {
+			continue
+		}
+
+		if !loaded {
+			var err error
+			if secret, credentials, err = sweepCredentials(s.ID); err != nil {
+				logrus.Errorf("get secret of sweep %s failed, err:%s", s.ID, err.Error())
+
+				break
+			}
+			loaded = true
+		}
+
+		if err := r.submit(s, t, secret, credentials); err != nil {
+			// the trials are submitted again in the next round unless they are invalid
+			if !isValidationError(err) {
+				break
+			}
+
+			continue
+		}
+		active++
+	}
+
+	s.Best = nil
+	done := true
+	for i := range s.Trials {
+		t := &s.Trials[i]
+		if !t.isDone() {
+			done = false
+		}
+
+		if t.Status != statusComplete || t.Metric == nil {
+			continue
+		}
+
+		if s.Best == nil || s.better(*t.Metric, *s.Best.Metric) {
+			v := *t
+			s.Best = &v
+		}
+	}
+
+	if done {
+		s.Status = sweepComplete
+	}
+}
+
+func (s *SweepInfo) better(a, b float64) bool {
+	if s.Goal == sweepGoalMin {
+		return a < b
+	}
+
+	return a > b
+}
+
+// submit creates the job of trial, the trial fails only if the job is invalid
+// and is left pending if the job can't be created for now.
+func (r *sweepRunner) submit(s *sweepRecord, t *SweepTrial, secret string, credentials map[string]string) error {
+	jobInfo := s.Base
+	jobInfo.Sweep = s.ID
+	jobInfo.Credentials = credentials
+	jobInfo.Parameter = make(map[string]string, len(s.Base.Parameter)+len(t.Parameter))
+	for k, v := range s.Base.Parameter {
+		jobInfo.Parameter[k] = v
+	}
+	for k, v := range t.Parameter {
+		jobInfo.Parameter[k] = v
+	}
+
+	job, err := submitJob(&jobInfo, secret)
+	if err != nil {
+		logrus.Errorf("create job of sweep %s failed, err:%s", s.ID, err.Error())
+
+		t.Error = err.Error()
+		if isValidationError(err) {
+			t.Status = statusFailed
+		}
+
+		return err
+	}
+
+	t.JobName, t.Status, t.Error = job.Name, statusQueued, ""
+
+	return nil
+}
+
+// isValidationError checks whether the error is caused by the invalid request which fails every time
+func isValidationError(err error) bool {
+	v, ok := err.(interface{ ErrorCode() int })
+
+	return ok && (v.ErrorCode() == allerror.ErrorBadRequestParam || v.ErrorCode() == allerror.ErrorBadRequestBody)
+}
+
+// cancel stops the sweep, the pending trials are not submitted and the jobs of others are cancelled
+func (r *sweepRunner) cancel(id, secret string) (SweepInfo, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	s, err := r.store.Get(id)
+	if err != nil {
+		return SweepInfo{}, err
+	}
+
+	if err := s.checkOwner(secret); err != nil {
+		return SweepInfo{}, err
+	}
+
+	if s.Status != sweepRunning {
+		return SweepInfo{}, allerror.New(allerror.ErrorFinetune, fmt.Sprintf("sweep %s is %s", id, s.Status))
+	}
+
+	for i := range s.Trials {
+		t := &s.Trials[i]
+		if t.isDone() {
+			continue
+		}
+
+		if t.JobName != "" {
+			if err := doCancelJob(t.JobName); err != nil {
+				logrus.Errorf("cancel job %s of sweep %s failed, err:%s", t.JobName, id, err.Error())
+			}
+		}
+
+		t.Status = statusCancelled
+	}
+
+	s.Status = sweepCancelled
+
+	if err := deleteSweepSecret(id); err != nil {
+		logrus.Errorf("delete secret of sweep %s failed, err:%s", id, err.Error())
+	}
+
+	if err := r.store.Save(&s); err != nil {
+		return SweepInfo{}, err
+	}
+
+	return s.SweepInfo, nil
+}
+
+// @Summary		Create
+// @Description	create a sweep which runs the base finetune with every configuration of the search space
+// @Tags			Finetune
+// @Param			body	body	SweepRequest	true	"body of creating sweep"
+// @Accept			json
+// @Success		200	{object}		SweepInfo
+// @Failure		500	system_error	system	error
+// @Router			/v1/finetune/sweeps [post]
+func createSweep(c *gin.Context) {
+	var req SweepRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		commonctl.SendBadRequestBody(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	if err := req.validate(); err != nil {
+		commonctl.SendBadRequestBody(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	if err := checkFinetuneToken(c); err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	if err := req.check(); err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	trials, err := req.trials()
+	if err != nil {
+		commonctl.SendBadRequestBody(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	credentials := req.Base.Credentials
+	req.Base.Credentials = nil
+	secret := c.GetHeader(headerSecret)
+
+	record := sweepRecord{
+		SweepInfo: SweepInfo{
+			ID:          uuid.NewString(),
+			Username:    req.Base.Username,
+			Base:        req.Base,
+			Method:      req.Method,
+			Metric:      req.Metric,
+			Goal:        req.Goal,
+			MaxParallel: req.MaxParallel,
+			CreatedAt:   time.Now().Format(time.RFC3339),
+			Status:      sweepRunning,
+			Trials:      trials,
+		},
+		Owner: ownerHash(secret),
+	}
+
+	if err := createSweepSecret(record.ID, secret, credentials); err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	if err := sweeps.store.Save(&record); err != nil {
+		if err := deleteSweepSecret(record.ID); err != nil {
+			logrus.Error(err.Error())
+		}
+
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	sweeps.notify()
+
+	c.JSON(http.StatusOK, record.SweepInfo)
+}
+
+// @Summary		List
+// @Description	list sweeps
+// @Tags			Finetune
+// @Param			username	query	string	false	"creator of sweep"
+// @Success		200	{object}		[]SweepInfo
+// @Failure		500	system_error	system	error
+// @Router			/v1/finetune/sweeps [get]
+func listSweeps(c *gin.Context) {
+	items, err := sweeps.store.List()
+	if err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	username := c.Query("username")
+
+	r := make([]SweepInfo, 0, len(items))
+	for i := range items {
+		if username == "" || items[i].Username == username {
+			r = append(r, items[i].SweepInfo)
+		}
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+// @Summary		Get
+// @Description	get a sweep with the status and metric of every trial and the best one
+// @Tags			Finetune
+// @Param			id	path	string	true	"sweep id"
+// @Success		200	{object}		SweepInfo
+// @Failure		500	system_error	system	error
+// @Router			/v1/finetune/sweeps/{id} [get]
+func getSweep(c *gin.Context) {
+	v, err := sweeps.store.Get(c.Param("id"))
+	if err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, v.SweepInfo)
+}
+
+// @Summary		Cancel
+// @Description	cancel a sweep, its pending trials are not submitted and the jobs of others are cancelled
+// @Tags			Finetune
+// @Param			id	path	string	true	"sweep id"
+// @Success		200	{object}		SweepInfo
+// @Failure		500	system_error	system	error
+// @Router			/v1/finetune/sweeps/{id}/cancel [post]
+func cancelSweep(c *gin.Context) {
+	if err := checkFinetuneToken(c); err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	v, err := sweeps.cancel(c.Param("id"), c.GetHeader(headerSecret))
+	if err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, v)
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/opensourceways/foundation-model-server/allerror"
+)
+
+const sweepFileSuffix = ".json"
+
+// localSweepStore saves every sweep as a JSON file
+type localSweepStore struct {
+	dir string
+}
+
+func newLocalSweepStore(dir string) (*localSweepStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &localSweepStore{dir: dir}, nil
+}
+
+func (s *localSweepStore) file(id string) (string, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return "", allerror.New(allerror.ErrorBadRequestParam, fmt.Sprintf("invalid sweep: %s", id))
+	}
+
+	return filepath.Join(s.dir, id+sweepFileSuffix), nil
+}
+
+func (s *localSweepStore) Save(r *sweepRecord) error {
+	path, err := s.file(r.ID)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, func(w *bufio.Writer) error {
+		return json.NewEncoder(w).Encode(r)
+	})
+}
+
+func (s *localSweepStore) Get(id string) (r sweepRecord, err error) {
+	path, err := s.file(id)
+	if err != nil {
+		return
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = allerror.NewNotFound(fmt.Sprintf("sweep %s not found", id))
+		}
+
+		return
+	}
+
+	err = json.Unmarshal(b, &r)
+
+	return
+}
+
+func (s *localSweepStore) List() ([]sweepRecord, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*"+sweepFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	r := make([]sweepRecord, 0, len(files))
+	for _, f := range files {
+		v, err := s.Get(strings.TrimSuffix(filepath.Base(f), sweepFileSuffix))
+		if err != nil {
+			return nil, err
+		}
+
+		r = append(r, v)
+	}
+
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].CreatedAt > r[j].CreatedAt
+	})
+
+	return r, nil
+}
@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSweepTrialsGrid(t *testing.T) {
+	sweepCfg.MaxTrials = 10
+
+	cases := []struct {
+		name    string
+		space   map[string][]string
+		want    []map[string]string
+		wantErr bool
+	}{
+		{
+			name:  "one parameter",
+			space: map[string][]string{"lr": {"1e-4", "1e-5"}},
+			want:  []map[string]string{{"lr": "1e-4"}, {"lr": "1e-5"}},
+		},
+		{
+			name:  "the last parameter changes fastest",
+			space: map[string][]string{"b": {"x", "y", "z"}, "a": {"1", "2"}},
+			want: []map[string]string{
+				{"a": "1", "b": "x"}, {"a": "1", "b": "y"}, {"a": "1", "b": "z"},
+				{"a": "2", "b": "x"}, {"a": "2", "b": "y"}, {"a": "2", "b": "z"},
+			},
+		},
+		{
+			name:    "too many trials",
+			space:   map[string][]string{"a": {"1", "2", "3", "4"}, "b": {"x", "y", "z"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := SweepRequest{Method: sweepGrid, Space: tc.space}
+
+			trials, err := req.trials()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := make([]map[string]string, len(trials))
+			for i := range trials {
+				if trials[i].Status != trialPending {
+					t.Errorf("trial %d is %s, want %s", i, trials[i].Status, trialPending)
+				}
+				got[i] = trials[i].Parameter
+			}
+
+			if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSweepTrialsRandom(t *testing.T) {
+	sweepCfg.MaxTrials = 10
+
+	space := map[string][]string{"a": {"1", "2"}, "b": {"x", "y", "z"}}
+
+	cases := []struct {
+		name    string
+		samples int
+		want    int
+		wantErr bool
+	}{
+		{name: "some of the grid", samples: 4, want: 4},
+		{name: "samples more than the grid", samples: 8, want: 6},
+		{name: "no sample", samples: 0, wantErr: true},
+		{name: "samples more than the max", samples: 11, wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := SweepRequest{Method: sweepRandom, Space: space, Samples: tc.samples}
+
+			trials, err := req.trials()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(trials) != tc.want {
+				t.Fatalf("got %d trials, want %d", len(trials), tc.want)
+			}
+
+			seen := map[string]bool{}
+			for _, trial := range trials {
+				a, b := trial.Parameter["a"], trial.Parameter["b"]
+				if !contains(space["a"], a) || !contains(space["b"], b) || len(trial.Parameter) != 2 {
+					t.Errorf("invalid trial: %v", trial.Parameter)
+				}
+
+				if seen[a+b] {
+					t.Errorf("duplicate trial: %v", trial.Parameter)
+				}
+				seen[a+b] = true
+			}
+		})
+	}
+}
+
+func contains(items []string, v string) bool {
+	for _, item := range items {
+		if item == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestSweepCheckOwner(t *testing.T) {
+	s := sweepRecord{Owner: ownerHash("token")}
+	if err := s.checkOwner("token"); err != nil {
+		t.Errorf("the owner is denied: %v", err)
+	}
+
+	if err := s.checkOwner("other"); err == nil {
+		t.Error("another token is allowed")
+	}
+
+	// the record without owner can't be changed by any token
+	if err := (&sweepRecord{}).checkOwner(""); err == nil {
+		t.Error("the sweep without owner is allowed")
+	}
+}
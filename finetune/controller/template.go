@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/opensourceways/foundation-model-server/allerror"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var (
+	templates       map[string]*JobTemplate
+	defaultTemplate string
+)
+
+func initTemplates(cfg *Config) {
+	templates = make(map[string]*JobTemplate, len(cfg.Templates))
+	for i := range cfg.Templates {
+		t := &cfg.Templates[i]
+		templates[t.Name] = t
+	}
+
+	defaultTemplate = cfg.DefaultTemplate
+}
+
+func getTemplate(name string) (*JobTemplate, error) {
+	if name == "" {
+		name = defaultTemplate
+	}
+
+	t, ok := templates[name]
+	if !ok {
+		return nil, allerror.New(allerror.ErrorBadRequestParam, fmt.Sprintf("unknown finetune template: %s", name))
+	}
+
+	return t, nil
+}
+
+// mergeParameters returns the default hyperparameters of template overridden by the ones of job
+func (t *JobTemplate) mergeParameters(parameter map[string]string) map[string]string {
+	r := make(map[string]string, len(t.Schema)+len(parameter))
+	for i := range t.Schema {
+		if p := &t.Schema[i]; p.Default != "" {
+			r[p.Name] = p.Default
+		}
+	}
+
+	for k, v := range t.Parameters {
+		r[k] = v
+	}
+
+	for k, v := range parameter {
+		r[k] = v
+	}
+
+	return r
+}
+
+func (r *TemplateResources) npuNumber() string {
+	return strconv.Itoa(r.NPU)
+}
+
+// npus returns the NPUs of all the nodes of job
+func (r *TemplateResources) npus() corev1.ResourceList {
+	return corev1.ResourceList{
+		corev1.ResourceName(r.NPUResource): *resource.NewQuantity(int64(r.NPU*r.Nodes), resource.DecimalSI),
+	}
+}
+
+func (r *TemplateResources) resourceList() corev1.ResourceList {
+	v := corev1.ResourceList{
+		corev1.ResourceName(r.NPUResource): resourceQuantity(r.npuNumber()),
+	}
+
+	if r.CPU != "" {
+		v[corev1.ResourceCPU] = resourceQuantity(r.CPU)
+	}
+
+	if r.Memory != "" {
+		v[corev1.ResourceMemory] = resourceQuantity(r.Memory)
+	}
+
+	return v
+}
+
+func (t *JobTemplate) modelMountPath(model string) string {
+	return t.Mounts.ModelDir + "/" + model
+}
+
+func (t *JobTemplate) datasetMountPath(dataset string) string {
+	return t.Mounts.DatasetDir + "/" + dataset + ".json"
+}
@@ -0,0 +1,191 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/utils/pointer"
+)
+
+const (
+	volumeModel   = "model"
+	volumeDataset = "dataset"
+	volumeOutput  = "output"
+)
+
+var volumeCfg VolumeConfig
+
+// VolumeConfig is the layout of volumes mounted by the finetune jobs
+type VolumeConfig struct {
+	Model        VolumeSource      `json:"model"`
+	Dataset      VolumeSource      `json:"dataset"`
+	Output       VolumeSource      `json:"output"`
+	NodeSelector map[string]string `json:"node_selector"`
+	Affinity     *corev1.Affinity  `json:"affinity"`
+}
+
+func (cfg *VolumeConfig) setDefault(datasetDir string) {
+	if cfg.Model.isEmpty() {
+		cfg.Model.HostPath = "/data/disk1/model"
+	}
+
+	if cfg.Dataset.isEmpty() {
+		cfg.Dataset.HostPath = datasetDir
+	}
+}
+
+func (cfg *VolumeConfig) validate() error {
+	if err := cfg.Model.validate(volumeModel, true); err != nil {
+		return err
+	}
+
+	if err := cfg.Dataset.validate(volumeDataset, true); err != nil {
+		return err
+	}
+
+	if err := cfg.Output.validate(volumeOutput, false); err != nil {
+		return err
+	}
+
+	for k, v := range cfg.NodeSelector {
+		if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+			return fmt.Errorf("invalid node selector key %s: %s", k, strings.Join(errs, ","))
+		}
+
+		if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+			return fmt.Errorf("invalid node selector value %s: %s", v, strings.Join(errs, ","))
+		}
+	}
+
+	return nil
+}
+
+// VolumeSource is either a PersistentVolumeClaim or a directory on the node
+type VolumeSource struct {
+	ClaimName string `json:"claim_name"`
+	HostPath  string `json:"host_path"`
+}
+
+func (v *VolumeSource) isEmpty() bool {
+	return v.ClaimName == "" && v.HostPath == ""
+}
+
+func (v *VolumeSource) validate(name string, required bool) error {
+	if v.isEmpty() {
+		if required {
+			return fmt.Errorf("missing %s volume of finetune", name)
+		}
+
+		return nil
+	}
+
+	if v.ClaimName != "" && v.HostPath != "" {
+		return fmt.Errorf("only one of claim_name and host_path can be set for %s volume", name)
+	}
+
+	if v.ClaimName != "" {
+		if errs := validation.IsDNS1123Subdomain(v.ClaimName); len(errs) > 0 {
+			return fmt.Errorf("invalid claim name of %s volume: %s", name, strings.Join(errs, ","))
+		}
+	}
+
+	if v.HostPath != "" && !filepath.IsAbs(v.HostPath) {
+		return fmt.Errorf("host path of %s volume must be absolute", name)
+	}
+
+	return nil
+}
+
+func (v *VolumeSource) volume(name string, readOnly bool) corev1.Volume {
+	if v.ClaimName != "" {
+		return corev1.Volume{
+			Name: name,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: v.ClaimName,
+					ReadOnly:  readOnly,
+				},
+			},
+		}
+	}
+
+	return corev1.Volume{
+		Name: name,
+		VolumeSource: corev1.VolumeSource{
+			HostPath: &corev1.HostPathVolumeSource{
+				Path: v.HostPath,
+				Type: (*corev1.HostPathType)(pointer.String(string(corev1.HostPathDirectory))),
+			},
+		},
+	}
+}
+
+// subPath checks that the path stays inside the volume
+func subPath(p string) (string, error) {
+	p = filepath.Clean(p)
+	if p == "." || filepath.IsAbs(p) || p == ".." || strings.HasPrefix(p, "../") {
+		return "", errors.New("invalid sub path")
+	}
+
+	return p, nil
+}
+
+// jobVolumes returns the volumes and the mounts of them for a job, the checkpoint
+// in the output volume is mounted if resumeFrom is set.
+func jobVolumes(tpl *JobTemplate, model *BaseModel, dataset, jobName, resumeFrom string) (
+	volumes []corev1.Volume, mounts []corev1.VolumeMount, err error,
+) {
+	modelPath, err := subPath(model.Path)
+	if err != nil {
+		return
+	}
+
+	datasetPath, err := subPath(dataset + datasetFileSuffix)
+	if err != nil {
+		return
+	}
+
+	volumes = []corev1.Volume{
+		volumeCfg.Model.volume(volumeModel, true),
+		volumeCfg.Dataset.volume(volumeDataset, true),
+	}
+
+	mounts = []corev1.VolumeMount{
+		{
+			Name:      volumeModel,
+			MountPath: tpl.modelMountPath(model.Name),
+			SubPath:   modelPath,
+			ReadOnly:  true,
+		},
+		{
+			Name:      volumeDataset,
+			MountPath: tpl.datasetMountPath(dataset),
+			SubPath:   datasetPath,
+			ReadOnly:  true,
+		},
+	}
+
+	if !volumeCfg.Output.isEmpty() {
+		volumes = append(volumes, volumeCfg.Output.volume(volumeOutput, false))
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      volumeOutput,
+			MountPath: tpl.Mounts.OutputDir,
+			SubPath:   jobName,
+		})
+
+		if resumeFrom != "" {
+			mounts = append(mounts, corev1.VolumeMount{
+				Name:      volumeOutput,
+				MountPath: tpl.Mounts.ResumeDir,
+				SubPath:   resumeFrom,
+				ReadOnly:  true,
+			})
+		}
+	}
+
+	return
+}
@@ -0,0 +1,732 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/opensourceways/foundation-model-server/allerror"
+	commonctl "github.com/opensourceways/foundation-model-server/common/controller"
+	"github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	annotationNotified = "finetune/notified"
+
+	eventQueued    = "queued"
+	eventRunning   = "running"
+	eventSucceeded = "succeeded"
+	eventFailed    = "failed"
+	eventCancelled = "cancelled"
+
+	headerWebhookEvent     = "X-Finetune-Event"
+	headerWebhookDelivery  = "X-Finetune-Delivery"
+	headerWebhookSignature = "X-Finetune-Signature"
+
+	maxDeliveries = 500
+)
+
+var (
+	webhookCfg WebhookConfig
+	notifier   *webhookNotifier
+
+	// sharedAddressSpace is the addresses of carrier-grade NAT which are not public either
+	sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+	// statusEvents maps the status of job to the event notified to the webhooks
+	statusEvents = map[string]string{
+		statusQueued:    eventQueued,
+		"Running":       eventRunning,
+		statusComplete:  eventSucceeded,
+		statusFailed:    eventFailed,
+		statusCancelled: eventCancelled,
+	}
+)
+
+// webhookStore saves the webhooks and the log of deliveries to them
+type webhookStore interface {
+	Save(r *webhookRecord) error
+	Get(id string) (webhookRecord, error)
+	List() ([]webhookRecord, error)
+	Delete(id string) error
+	AppendDelivery(id string, d *WebhookDelivery) error
+	ListDeliveries(id string) ([]WebhookDelivery, error)
+}
+
+// WebhookConfig
+type WebhookConfig struct {
+	Dir string `json:"dir"`
+	// Interval is the max seconds between two rounds of checking the status of jobs
+	Interval int `json:"interval"`
+	// Timeout is the seconds to wait for the response of a delivery
+	Timeout int `json:"timeout"`
+	// MaxAttempts is the max number of attempts of a delivery
+	MaxAttempts int `json:"max_attempts"`
+	// Backoff is the seconds before the first retry, it is doubled for every retry up to MaxBackoff
+	Backoff    int `json:"backoff"`
+	MaxBackoff int `json:"max_backoff"`
+	// AllowPrivate allows the webhooks on the loopback, private and link-local addresses
+	AllowPrivate bool `json:"allow_private"`
+}
+
+func (cfg *WebhookConfig) setDefault() {
+	if cfg.Dir == "" {
+		cfg.Dir = "/data/disk1/webhooks"
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = 30
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10
+	}
+
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = 10
+	}
+
+	if cfg.MaxBackoff < cfg.Backoff {
+		cfg.MaxBackoff = 600
+	}
+}
+
+// WebhookRequest is the body of registering a webhook
+type WebhookRequest struct {
+	Username string `json:"username" required:"true"`
+	// JobName is the job to notify, all the jobs of user are notified if empty
+	JobName string `json:"jobName"`
+	URL     string `json:"url"      required:"true"`
+	// Events are the events to notify, all the events are notified if empty
+	Events []string `json:"events"`
+	// Secret is the key of HMAC-SHA256 signature of the body, it is generated if empty
+	Secret string `json:"secret"`
+}
+
+func (req *WebhookRequest) validate() error {
+	if req.Username == "" {
+		return errors.New("missing username")
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("invalid webhook url: %s", req.URL)
+	}
+
+	if err := checkWebhookHost(u.Hostname()); err != nil {
+		return err
+	}
+
+	valid := map[string]bool{}
+	for _, v := range statusEvents {
+		valid[v] = true
+	}
+
+	for _, v := range req.Events {
+		if !valid[v] {
+			return fmt.Errorf("unknown event: %s", v)
+		}
+	}
+
+	return nil
+}
+
+// Webhook
+type Webhook struct {
+	ID        string   `json:"id"`
+	Username  string   `json:"username"`
+	JobName   string   `json:"jobName,omitempty"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events,omitempty"`
+	CreatedAt string   `json:"created_at"`
+}
+
+// match checks whether the webhook is notified of the event of job. The webhook is notified
+// of the jobs created by the same token as the webhook only.
+func (w *webhookRecord) match(job *batchv1.Job, event string) bool {
+	if w.Owner == "" || jobOwnerHash(job) != w.Owner {
+		return false
+	}
+
+	if w.JobName != "" {
+		if w.JobName != job.Name {
+			return false
+		}
+	} else if w.Username != job.Labels["create_by"] {
+		return false
+	}
+
+	if len(w.Events) == 0 {
+		return true
+	}
+
+	for _, v := range w.Events {
+		if v == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// webhookRecord is the webhook saved in the store, the secret is only returned when it is registered.
+// Owner is the hash of token which registered the webhook.
+type webhookRecord struct {
+	Webhook
+
+	Secret string `json:"secret"`
+	Owner  string `json:"owner,omitempty"`
+}
+
+// isOwner checks whether the webhook is registered by the token
+func (w *webhookRecord) isOwner(secret string) bool {
+	return secret != "" && w.Owner != "" &&
+		subtle.ConstantTimeCompare([]byte(w.Owner), []byte(ownerHash(secret))) == 1
+}
+
+// checkOwner checks whether the webhook is registered by the token
+func (w *webhookRecord) checkOwner(secret string) error {
+	if secret == "" {
+		return allerror.New(allerror.ErrorPermissionDeny, "Permission denied, empty finetune token")
+	}
+
+	if !w.isOwner(secret) {
+		return allerror.New(allerror.ErrorPermissionDeny, "Permission denied, the webhook is registered by others")
+	}
+
+	return nil
+}
+
+// publicIP checks whether the ip is a public address which the webhooks can be posted to
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || sharedAddressSpace.Contains(ip))
+}
+
+// checkWebhookHost rejects the host which is resolved to an address which is not public
+func checkWebhookHost(host string) error {
+	if webhookCfg.AllowPrivate {
+		return nil
+	}
+
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		v, err := net.LookupIP(host)
+		if err != nil {
+			return fmt.Errorf("can't resolve the host of webhook: %s", host)
+		}
+
+		ips = v
+	}
+
+	for _, ip := range ips {
+		if !publicIP(ip) {
+			return fmt.Errorf("the host of webhook is not public: %s", host)
+		}
+	}
+
+	return nil
+}
+
+// newWebhookClient returns the client which only connects to the public addresses,
+// the address is checked when connecting because the host may be resolved differently.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: time.Duration(webhookCfg.Timeout) * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if webhookCfg.AllowPrivate {
+				return nil
+			}
+
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return fmt.Errorf("the address of webhook is not public: %s", host)
+			}
+
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   time.Duration(webhookCfg.Timeout) * time.Second,
+		Transport: transport,
+	}
+}
+
+// WebhookPayload is the body of notification
+type WebhookPayload struct {
+	ID    string  `json:"id"`
+	Event string  `json:"event"`
+	Time  string  `json:"time"`
+	Job   JobInfo `json:"job"`
+}
+
+// WebhookDelivery is an attempt of delivering a notification
+type WebhookDelivery struct {
+	ID         string `json:"id"`
+	Event      string `json:"event"`
+	JobName    string `json:"jobName"`
+	Attempt    int    `json:"attempt"`
+	Time       string `json:"time"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Success    bool   `json:"success"`
+	Error      string `json:"error,omitempty"`
+}
+
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// webhookNotifier notifies the webhooks when the status of job changes. The last notified
+// event is recorded on the job, so the transitions are not lost when the server restarts.
+type webhookNotifier struct {
+	store   webhookStore
+	client  *http.Client
+	started time.Time
+	// notified is the event set on the job which may be not in the cache yet
+	notified map[string]string
+}
+
+func newWebhookNotifier(store webhookStore) *webhookNotifier {
+	return &webhookNotifier{
+		store:    store,
+		client:   newWebhookClient(),
+		started:  time.Now(),
+		notified: map[string]string{},
+	}
+}
+
+func (n *webhookNotifier) run() {
+	interval := time.Duration(webhookCfg.Interval) * time.Second
+
+	for {
+		if err := n.check(); err != nil {
+			logrus.Errorf("notify webhooks failed, err:%s", err.Error())
+		}
+
+		jobs.waitChange(interval)
+	}
+}
+
+func (n *webhookNotifier) check() error {
+	jobList, err := jobs.listJobs()
+	if err != nil {
+		return err
+	}
+
+	hooks, err := n.store.List()
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]string, len(n.notified))
+
+	for _, job := range jobList {
+		status := jobStatus(job)
+
+		event := statusEvents[status]
+		notified := job.Annotations[annotationNotified]
+		if v, ok := n.notified[job.Name]; ok {
+			notified = v
+		}
+
+		if event == "" || event == notified {
+			if notified != job.Annotations[annotationNotified] {
+				current[job.Name] = notified
+			}
+
+			continue
+		}
+
+		cl, err := clusterOf(job)
+		if err != nil {
+			logrus.Errorf("notify job %s failed, err:%s", job.Name, err.Error())
+
+			continue
+		}
+
+		if err := setNotified(cl, job.Name, event); err != nil {
+			logrus.Errorf("set notified event of job %s failed, err:%s", job.Name, err.Error())
+
+			continue
+		}
+		current[job.Name] = event
+
+		// the jobs which finished before the notifier ran are not notified
+		if notified == "" && isTerminalStatus(status) && job.CreationTimestamp.Time.Before(n.started) {
+			continue
+		}
+
+		for i := range hooks {
+			if hooks[i].match(job, event) {
+				go n.deliver(hooks[i], job, event)
+			}
+		}
+	}
+
+	n.notified = current
+
+	return nil
+}
+
+func setNotified(cl *cluster, jobName, event string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{annotationNotified: event},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = cl.clientset.BatchV1().Jobs(cl.Namespace).Patch(
+		context.TODO(), jobName, types.MergePatchType, patch, metav1.PatchOptions{},
+	)
+
+	return err
+}
+
+// deliver posts the notification until it succeeds or the attempts run out
+func (n *webhookNotifier) deliver(hook webhookRecord, job *batchv1.Job, event string) {
+	info, err := toJobInfo(job)
+	if err != nil {
+		logrus.Errorf("notify job %s failed, err:%s", job.Name, err.Error())
+
+		return
+	}
+
+	payload := WebhookPayload{
+		ID:    uuid.NewString(),
+		Event: event,
+		Time:  time.Now().Format(time.RFC3339),
+		Job:   info,
+	}
+
+	body, err := json.Marshal(&payload)
+	if err != nil {
+		logrus.Errorf("notify job %s failed, err:%s", job.Name, err.Error())
+
+		return
+	}
+
+	backoff := time.Duration(webhookCfg.Backoff) * time.Second
+	maxBackoff := time.Duration(webhookCfg.MaxBackoff) * time.Second
+
+	for attempt := 1; ; attempt++ {
+		code, err := n.post(&hook, &payload, body)
+
+		d := WebhookDelivery{
+			ID:         payload.ID,
+			Event:      event,
+			JobName:    job.Name,
+			Attempt:    attempt,
+			Time:       time.Now().Format(time.RFC3339),
+			StatusCode: code,
+			Success:    err == nil,
+		}
+		if err != nil {
+			d.Error = err.Error()
+		}
+
+		if err := n.store.AppendDelivery(hook.ID, &d); err != nil {
+			logrus.Errorf("save delivery of webhook %s failed, err:%s", hook.ID, err.Error())
+		}
+
+		if d.Success || attempt >= webhookCfg.MaxAttempts {
+			return
+		}
+
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+
+		// stop retrying if the webhook is deleted
+		if _, err := n.store.Get(hook.ID); err != nil {
+			return
+		}
+	}
+}
+
+func (n *webhookNotifier) post(hook *webhookRecord, payload *WebhookPayload, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(headerWebhookEvent, payload.Event)
+	req.Header.Set(headerWebhookDelivery, payload.ID)
+	req.Header.Set(headerWebhookSignature, signPayload(hook.Secret, body))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// @Summary		Create
+// @Description	register a webhook which is notified when the status of job changes, the secret is only returned here
+// @Tags			Finetune
+// @Param			body	body	WebhookRequest	true	"body of registering webhook"
+// @Accept			json
+// @Success		200	{object}		Webhook
+// @Failure		500	system_error	system	error
+// @Router			/v1/finetune/webhooks [post]
+func createWebhook(c *gin.Context) {
+	if err := checkFinetuneToken(c); err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		commonctl.SendBadRequestBody(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	if err := req.validate(); err != nil {
+		commonctl.SendBadRequestBody(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	secret := c.GetHeader(headerSecret)
+
+	if req.JobName != "" {
+		err := checkJobPerm(req.JobName, secret, "watch")
+		if err != nil {
+			commonctl.SendFailedResp(c, err)
+			logrus.Error(err.Error())
+			return
+		}
+	}
+
+	if req.Secret == "" {
+		v, err := newWebhookSecret()
+		if err != nil {
+			commonctl.SendFailedResp(c, err)
+			logrus.Error(err.Error())
+			return
+		}
+
+		req.Secret = v
+	}
+
+	record := webhookRecord{
+		Webhook: Webhook{
+			ID:        uuid.NewString(),
+			Username:  req.Username,
+			JobName:   req.JobName,
+			URL:       req.URL,
+			Events:    req.Events,
+			CreatedAt: time.Now().Format(time.RFC3339),
+		},
+		Secret: req.Secret,
+		Owner:  ownerHash(secret),
+	}
+
+	if err := notifier.store.Save(&record); err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	// the owner is not returned
+	c.JSON(http.StatusOK, struct {
+		Webhook
+
+		Secret string `json:"secret"`
+	}{record.Webhook, record.Secret})
+}
+
+// @Summary		List
+// @Description	list the webhooks registered by the token
+// @Tags			Finetune
+// @Param			username	query	string	false	"owner of webhook"
+// @Param			jobname		query	string	false	"finetune id"
+// @Success		200	{object}		[]Webhook
+// @Failure		500	system_error	system	error
+// @Router			/v1/finetune/webhooks [get]
+func listWebhooks(c *gin.Context) {
+	if err := checkFinetuneToken(c); err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	items, err := notifier.store.List()
+	if err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	secret := c.GetHeader(headerSecret)
+	username, jobName := c.Query("username"), c.Query("jobname")
+
+	// only the webhooks registered by the token are listed
+	r := make([]Webhook, 0, len(items))
+	for i := range items {
+		if !items[i].isOwner(secret) {
+			continue
+		}
+
+		v := &items[i].Webhook
+		if (username == "" || v.Username == username) && (jobName == "" || v.JobName == jobName) {
+			r = append(r, *v)
+		}
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+// @Summary		Delete
+// @Description	delete a webhook and its deliveries
+// @Tags			Finetune
+// @Param			id	path	string	true	"webhook id"
+// @Success		200
+// @Failure		500	system_error	system	error
+// @Router			/v1/finetune/webhooks/{id} [delete]
+func deleteWebhook(c *gin.Context) {
+	if err := checkFinetuneToken(c); err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	id := c.Param("id")
+
+	hook, err := notifier.store.Get(id)
+	if err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	if err := hook.checkOwner(c.GetHeader(headerSecret)); err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	if err := notifier.store.Delete(id); err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"msg": fmt.Sprintf("Webhook %s deleted", id),
+	})
+}
+
+// @Summary		Deliveries
+// @Description	list the deliveries of a webhook from the newest, every attempt is a delivery
+// @Tags			Finetune
+// @Param			id		path	string	true	"webhook id"
+// @Param			limit	query	int		false	"max deliveries, default 100"
+// @Success		200	{object}		[]WebhookDelivery
+// @Failure		500	system_error	system	error
+// @Router			/v1/finetune/webhooks/{id}/deliveries [get]
+func listWebhookDeliveries(c *gin.Context) {
+	if err := checkFinetuneToken(c); err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	limit := 100
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxDeliveries {
+			err = allerror.New(allerror.ErrorBadRequestParam, fmt.Sprintf("limit should be in [1, %d]", maxDeliveries))
+			commonctl.SendBadRequestParam(c, err)
+			logrus.Error(err.Error())
+			return
+		}
+
+		limit = n
+	}
+
+	hook, err := notifier.store.Get(c.Param("id"))
+	if err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	if err := hook.checkOwner(c.GetHeader(headerSecret)); err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	items, err := notifier.store.ListDeliveries(hook.ID)
+	if err != nil {
+		commonctl.SendFailedResp(c, err)
+		logrus.Error(err.Error())
+		return
+	}
+
+	r := make([]WebhookDelivery, 0, limit)
+	for i := len(items) - 1; i >= 0 && len(r) < limit; i-- {
+		r = append(r, items[i])
+	}
+
+	c.JSON(http.StatusOK, r)
+}
@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/opensourceways/foundation-model-server/allerror"
+)
+
+const (
+	webhookFileSuffix     = ".json"
+	webhookDeliverySuffix = ".deliveries.jsonl"
+)
+
+// localWebhookStore saves every webhook as a JSON file with its deliveries as a JSON lines file beside it
+type localWebhookStore struct {
+	dir   string
+	mutex sync.Mutex
+}
+
+func newLocalWebhookStore(dir string) (*localWebhookStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &localWebhookStore{dir: dir}, nil
+}
+
+func (s *localWebhookStore) file(id, suffix string) (string, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return "", allerror.New(allerror.ErrorBadRequestParam, fmt.Sprintf("invalid webhook: %s", id))
+	}
+
+	return filepath.Join(s.dir, id+suffix), nil
+}
+
+func (s *localWebhookStore) Save(r *webhookRecord) error {
+	path, err := s.file(r.ID, webhookFileSuffix)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, func(w *bufio.Writer) error {
+		return json.NewEncoder(w).Encode(r)
+	})
+}
+
+func (s *localWebhookStore) Get(id string) (r webhookRecord, err error) {
+	path, err := s.file(id, webhookFileSuffix)
+	if err != nil {
+		return
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = allerror.NewNotFound(fmt.Sprintf("webhook %s not found", id))
+		}
+
+		return
+	}
+
+	err = json.Unmarshal(b, &r)
+
+	return
+}
+
+func (s *localWebhookStore) List() ([]webhookRecord, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*"+webhookFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	r := make([]webhookRecord, 0, len(files))
+	for _, f := range files {
+		v, err := s.Get(strings.TrimSuffix(filepath.Base(f), webhookFileSuffix))
+		if err != nil {
+			return nil, err
+		}
+
+		r = append(r, v)
+	}
+
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].CreatedAt > r[j].CreatedAt
+	})
+
+	return r, nil
+}
+
+func (s *localWebhookStore) Delete(id string) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+
+	path, err := s.file(id, webhookFileSuffix)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	deliveries, _ := s.file(id, webhookDeliverySuffix)
+	if err := os.Remove(deliveries); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *localWebhookStore) AppendDelivery(id string, d *WebhookDelivery) error {
+	path, err := s.file(id, webhookDeliverySuffix)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// only the latest deliveries are kept
+	if lines := strings.SplitAfter(strings.TrimSuffix(string(data), "\n"), "\n"); len(data) > 0 && len(lines) >= maxDeliveries {
+		lines = lines[len(lines)-maxDeliveries+1:]
+
+		return writeFileAtomic(path, func(w *bufio.Writer) error {
+			for _, line := range lines {
+				if _, err := w.WriteString(strings.TrimSuffix(line, "\n") + "\n"); err != nil {
+					return err
+				}
+			}
+
+			_, err := w.Write(append(b, '\n'))
+
+			return err
+		})
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	return f.Close()
+}
+
+func (s *localWebhookStore) ListDeliveries(id string) ([]WebhookDelivery, error) {
+	if _, err := s.Get(id); err != nil {
+		return nil, err
+	}
+
+	path, err := s.file(id, webhookDeliverySuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	r := []WebhookDelivery{}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return r, nil
+		}
+
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var d WebhookDelivery
+		if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
+			continue
+		}
+
+		r = append(r, d)
+	}
+
+	return r, scanner.Err()
+}
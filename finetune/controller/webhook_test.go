@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"net"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSignPayload(t *testing.T) {
+	cases := []struct {
+		secret string
+		body   string
+		want   string
+	}{
+		{
+			secret: "key",
+			body:   "The quick brown fox jumps over the lazy dog",
+			want:   "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8",
+		},
+		{
+			secret: "",
+			body:   "",
+			want:   "sha256=b613679a0814d9ec772f95d778c35fc5ff1697c493715653c6c712144292c5ad",
+		},
+	}
+
+	for _, tc := range cases {
+		if got := signPayload(tc.secret, []byte(tc.body)); got != tc.want {
+			t.Errorf("signPayload(%q, %q) = %s, want %s", tc.secret, tc.body, got, tc.want)
+		}
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	cases := []struct {
+		ip   string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"2001:4860:4860::8888", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"fc00::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+	}
+
+	for _, tc := range cases {
+		if got := publicIP(net.ParseIP(tc.ip)); got != tc.want {
+			t.Errorf("publicIP(%s) = %v, want %v", tc.ip, got, tc.want)
+		}
+	}
+}
+
+func TestWebhookOwner(t *testing.T) {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "job",
+			Labels:      map[string]string{"create_by": "alice"},
+			Annotations: map[string]string{annotationOwner: ownerHash("token")},
+		},
+	}
+
+	owned := webhookRecord{Webhook: Webhook{Username: "alice"}, Owner: ownerHash("token")}
+	legacy := webhookRecord{Webhook: Webhook{Username: "alice", JobName: "job"}}
+
+	if !owned.isOwner("token") || owned.isOwner("other") || owned.isOwner("") {
+		t.Error("the owner of webhook is checked wrongly")
+	}
+
+	if !owned.match(job, eventSucceeded) {
+		t.Error("the webhook of owner is not notified")
+	}
+
+	// the webhook registered without owner is neither managed nor notified
+	if legacy.isOwner("token") || legacy.checkOwner("token") == nil {
+		t.Error("the webhook without owner is managed")
+	}
+
+	if legacy.match(job, eventSucceeded) {
+		t.Error("the webhook without owner is notified")
+	}
+}